@@ -0,0 +1,568 @@
+package pia
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Auth configures how the requests of a transaction are authenticated. The options which apply depend on Type, which is
+// one of the following.
+//
+//   - "basic" sends Username and Password using HTTP basic authentication.
+//   - "bearer" sends Token in the Authorization header, prefixed by Prefix which defaults to "Bearer".
+//   - "digest" sends Username and Password using HTTP digest authentication. The request is sent without credentials
+//     first and then sent again answering the challenge of the server, which means that its body is buffered in memory.
+//   - "apikey" sends Value as the header named Name, or as the query parameter named Name if In is "query".
+//   - "hmac" signs the request using Secret, see [pia.Auth.Canonical].
+//   - "aws_sigv4" signs the request using AWS Signature Version 4 with AccessKey, SecretKey and, if set,
+//     SessionToken for the Service in the Region.
+//   - "oauth2" obtains a token from the TokenURL of an OAuth 2.0 authorization server and sends it as a bearer token,
+//     see [pia.Auth.Grant].
+//
+// Credentials are usually pulled from a [pia.KeyResolver] by interpolation, such as "${vault:password}". Requests are
+// authenticated by [pia.Transaction.Execute] right before being sent, after the before hook has run.
+type Auth struct {
+	Type     string `yaml:"type"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+	Prefix   string `yaml:"prefix"`
+	Name     string `yaml:"name"`
+	Value    string `yaml:"value"`
+	In       string `yaml:"in"`
+	Secret   string `yaml:"secret"`
+	// Algorithm is the hash function used by "hmac", either "sha1", "sha256" or "sha512". Defaults to "sha256".
+	Algorithm string `yaml:"algorithm"`
+	// Canonical is the template of the string signed by "hmac". It may contain the placeholders {method}, {url},
+	// {host}, {path}, {query}, {body}, {body_sha256} and {header:Name}, which are replaced by the corresponding parts of
+	// the request. The query is used as it is sent and the body hash is hex encoded. Defaults to
+	// "{method}\n{path}\n{query}\n{body_sha256}".
+	Canonical string `yaml:"canonical"`
+	// Header is the name of the header carrying the "hmac" signature. Defaults to "Authorization".
+	Header string `yaml:"header"`
+	// Format is the template of the value of the header carrying the "hmac" signature, where {signature} is replaced by
+	// the signature. Defaults to "{signature}".
+	Format string `yaml:"format"`
+	// Encoding of the "hmac" signature, either "hex" or "base64". Defaults to "hex".
+	Encoding     string `yaml:"encoding"`
+	AccessKey    string `yaml:"access_key"`
+	SecretKey    string `yaml:"secret_key"`
+	SessionToken string `yaml:"session_token"`
+	Region       string `yaml:"region"`
+	Service      string `yaml:"service"`
+	TokenURL     string `yaml:"token_url"`
+	// Grant is the grant used by "oauth2" to obtain a token, either "client_credentials", "password", which sends
+	// Username and Password, or "refresh_token", which sends RefreshToken. Tokens are cached in the session along with
+	// their expiry and any refresh token issued with them, which is used to obtain a new token once the cached one is
+	// about to expire. The configured grant is used again if the refresh token is rejected.
+	Grant        string `yaml:"grant"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	Scope        string `yaml:"scope"`
+	RefreshToken string `yaml:"refresh_token"`
+	// ClientAuth is how "oauth2" authenticates the client to the authorization server, either "basic", which uses HTTP
+	// basic authentication, or "body", which sends ClientID and ClientSecret as form parameters. Defaults to "basic".
+	ClientAuth string `yaml:"client_auth"`
+	// SessionKey prefixes the keys of the session under which "oauth2" caches its token, which are "<key>_access_token",
+	// "<key>_expires_at" and "<key>_refresh_token". Defaults to "oauth2".
+	SessionKey string `yaml:"session_key"`
+	// RefreshBefore is how long before its expiry a token cached by "oauth2" is replaced. Defaults to 30 seconds.
+	RefreshBefore time.Duration `yaml:"refresh_before"`
+
+	// now and cnonce are replaced when testing against known signatures.
+	now    func() time.Time
+	cnonce func() string
+}
+
+func (a *Auth) validate() error {
+	switch a.Type {
+	case "":
+	case "basic", "digest":
+		if a.Username == "" {
+			return fmt.Errorf("%s auth requires a username", a.Type)
+		}
+	case "bearer":
+		if a.Token == "" {
+			return errors.New("bearer auth requires a token")
+		}
+	case "apikey":
+		if a.Name == "" {
+			return errors.New("apikey auth requires a name")
+		}
+		if a.In != "" && a.In != "header" && a.In != "query" {
+			return fmt.Errorf("apikey auth cannot be sent in %s: expected header or query", a.In)
+		}
+	case "hmac":
+		if a.Secret == "" {
+			return errors.New("hmac auth requires a secret")
+		}
+		if _, err := hmacHash(a.Algorithm); err != nil {
+			return err
+		}
+		if a.Encoding != "" && a.Encoding != "hex" && a.Encoding != "base64" {
+			return fmt.Errorf("unsupported hmac encoding %s: expected hex or base64", a.Encoding)
+		}
+	case "aws_sigv4":
+		if a.AccessKey == "" || a.SecretKey == "" || a.Region == "" || a.Service == "" {
+			return errors.New("aws_sigv4 auth requires an access_key, secret_key, region and service")
+		}
+	case "oauth2":
+		return a.validateOAuth2()
+	default:
+		return fmt.Errorf("unsupported auth type: %s", a.Type)
+	}
+	return nil
+}
+
+// send authenticates the request and sends it using the client. Tokens obtained by "oauth2" are cached in the session,
+// which may be nil.
+func (a *Auth) send(client *http.Client, req *http.Request, session *Session) (*http.Response, error) {
+	switch a.Type {
+	case "digest":
+		return a.digest(client, req)
+	case "oauth2":
+		token, err := a.token(req.Context(), client, session)
+		if err != nil {
+			return nil, err
+		}
+		prefix := a.Prefix
+		if prefix == "" {
+			prefix = "Bearer"
+		}
+		req.Header.Set("Authorization", prefix+" "+token)
+		return client.Do(req)
+	}
+	if err := a.authorize(req); err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// authorize adds the credentials of every type but digest and oauth2 to the request.
+func (a *Auth) authorize(req *http.Request) error {
+	switch a.Type {
+	case "basic":
+		req.SetBasicAuth(a.Username, a.Password)
+	case "bearer":
+		prefix := a.Prefix
+		if prefix == "" {
+			prefix = "Bearer"
+		}
+		req.Header.Set("Authorization", prefix+" "+a.Token)
+	case "apikey":
+		if a.In == "query" {
+			setQuery(req.URL, a.Name, a.Value)
+		} else {
+			req.Header.Set(a.Name, a.Value)
+		}
+	case "hmac":
+		return a.hmac(req)
+	case "aws_sigv4":
+		return a.sigv4(req)
+	}
+	return nil
+}
+
+func (a *Auth) hmac(req *http.Request) error {
+	body, err := buffer(req)
+	if err != nil {
+		return err
+	}
+	canonical := a.Canonical
+	if canonical == "" {
+		canonical = "{method}\n{path}\n{query}\n{body_sha256}"
+	}
+	msg, err := expand(canonical, func(placeholder string) (string, bool) {
+		if name, ok := strings.CutPrefix(placeholder, "header:"); ok {
+			return req.Header.Get(name), true
+		}
+		switch placeholder {
+		case "method":
+			return req.Method, true
+		case "url":
+			return req.URL.String(), true
+		case "host":
+			return host(req), true
+		case "path":
+			return req.URL.EscapedPath(), true
+		case "query":
+			return req.URL.RawQuery, true
+		case "body":
+			return string(body), true
+		case "body_sha256":
+			return hashHex(sha256.New, body), true
+		default:
+			return "", false
+		}
+	})
+	if err != nil {
+		return err
+	}
+	h, err := hmacHash(a.Algorithm)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(h, []byte(a.Secret))
+	mac.Write([]byte(msg))
+	signature := hex.EncodeToString(mac.Sum(nil))
+	if a.Encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	format := a.Format
+	if format == "" {
+		format = "{signature}"
+	}
+	header := a.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	req.Header.Set(header, strings.ReplaceAll(format, "{signature}", signature))
+	return nil
+}
+
+func (a *Auth) clock() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
+
+func hmacHash(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported hmac algorithm %s: expected sha1, sha256 or sha512", algorithm)
+	}
+}
+
+// expand replaces every placeholder enclosed in braces within template by the value returned by lookup. An error is
+// returned for placeholders which lookup does not recognize.
+func expand(template string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			b.WriteString(template)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated placeholder in %q", template)
+		}
+		value, ok := lookup(template[start+1 : start+end])
+		if !ok {
+			return "", fmt.Errorf("unrecognized placeholder %s", template[start:start+end+1])
+		}
+		b.WriteString(template[:start])
+		b.WriteString(value)
+		template = template[start+end+1:]
+	}
+}
+
+func (a *Auth) sigv4(req *http.Request) error {
+	body, err := buffer(req)
+	if err != nil {
+		return err
+	}
+	t := a.clock().UTC()
+	date := t.Format("20060102")
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+	payload := hashHex(sha256.New, body)
+	if a.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+
+	// The path is sent encoded the way it is signed. Every service but S3 expects the encoded path to be encoded once
+	// more when signing.
+	path := awsEncode(req.URL.Path, false)
+	if path == "" {
+		path = "/"
+	}
+	req.URL.RawPath = path
+	if a.Service != "s3" {
+		path = awsEncode(path, false)
+	}
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return err
+	}
+	params := make([]string, 0, len(query))
+	for k, values := range query {
+		for _, v := range values {
+			params = append(params, awsEncode(k, true)+"="+awsEncode(v, true))
+		}
+	}
+	slices.Sort(params)
+	headers := map[string]string{"host": host(req)}
+	for k, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(k)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	var canonicalHeaders strings.Builder
+	for k := range headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	scope := strings.Join([]string{date, a.Region, a.Service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format("20060102T150405Z"),
+		scope,
+		hashHex(sha256.New, []byte(canonical)),
+	}, "\n")
+	key := []byte("AWS4" + a.SecretKey)
+	for _, part := range []string{date, a.Region, a.Service, "aws4_request"} {
+		key = hmacSum(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.AccessKey,
+		scope,
+		signed,
+		hex.EncodeToString(hmacSum(key, toSign)),
+	))
+	return nil
+}
+
+// awsEncode percent-encodes every byte of s except the unreserved characters of RFC 3986, as expected by AWS. Slashes
+// are left alone unless slash is set.
+func awsEncode(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (a *Auth) digest(client *http.Client, req *http.Request) (*http.Response, error) {
+	body, err := buffer(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	challenge, ok := digestChallenge(res.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return res, nil
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	authorization, err := a.digestAuthorization(req, challenge, body)
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, _ = req.GetBody()
+	}
+	retry.Header.Set("Authorization", authorization)
+	return client.Do(retry)
+}
+
+// digestChallenge returns the parameters of the first digest challenge found within the WWW-Authenticate headers.
+func digestChallenge(headers []string) (map[string]string, bool) {
+	for _, header := range headers {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		return authParams(params), true
+	}
+	return nil, false
+}
+
+// authParams parses the comma-separated list of parameters of an authentication challenge, whose values may be quoted.
+func authParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		k, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		k = strings.ToLower(strings.TrimSpace(k))
+		rest = strings.TrimLeft(rest, " \t")
+		var v strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				v.WriteByte(rest[i])
+			}
+			rest = rest[min(i+1, len(rest)):]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			v.WriteString(strings.TrimSpace(rest[:end]))
+			rest = rest[end:]
+		}
+		params[k] = v.String()
+		s = rest
+	}
+}
+
+// digestAuthorization answers the digest challenge according to RFC 7616.
+func (a *Auth) digestAuthorization(req *http.Request, challenge map[string]string, body []byte) (string, error) {
+	algorithm := challenge["algorithm"]
+	var h func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		h = md5.New
+	case "SHA-256":
+		h = sha256.New
+	case "SHA-512-256":
+		h = sha512.New512_256
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+	var qop string
+	for _, offered := range strings.Split(challenge["qop"], ",") {
+		offered = strings.TrimSpace(offered)
+		if offered == "auth" || (offered == "auth-int" && qop == "") {
+			qop = offered
+		}
+	}
+	cnonce := a.cnonce
+	if cnonce == nil {
+		cnonce = func() string {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			return hex.EncodeToString(b)
+		}
+	}
+	realm, nonce, nc, cn := challenge["realm"], challenge["nonce"], "00000001", cnonce()
+	uri := req.URL.RequestURI()
+
+	ha1 := hashHex(h, []byte(a.Username+":"+realm+":"+a.Password))
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = hashHex(h, []byte(ha1+":"+nonce+":"+cn))
+	}
+	a2 := req.Method + ":" + uri
+	if qop == "auth-int" {
+		a2 += ":" + hashHex(h, body)
+	}
+	ha2 := hashHex(h, []byte(a2))
+	var response string
+	if qop == "" {
+		response = hashHex(h, []byte(ha1+":"+nonce+":"+ha2))
+	} else {
+		response = hashHex(h, []byte(strings.Join([]string{ha1, nonce, nc, cn, qop, ha2}, ":")))
+	}
+
+	params := []string{
+		fmt.Sprintf("username=%q", a.Username),
+		fmt.Sprintf("realm=%q", realm),
+		fmt.Sprintf("nonce=%q", nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if algorithm != "" {
+		params = append(params, "algorithm="+algorithm)
+	}
+	if qop != "" {
+		params = append(params, "qop="+qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cn))
+	}
+	params = append(params, fmt.Sprintf("response=%q", response))
+	if opaque, ok := challenge["opaque"]; ok {
+		params = append(params, fmt.Sprintf("opaque=%q", opaque))
+	}
+	return "Digest " + strings.Join(params, ", "), nil
+}
+
+func hashHex(h func() hash.Hash, data []byte) string {
+	d := h()
+	d.Write(data)
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// host returns the host the request is sent to, as given by its Host header.
+func host(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// buffer reads the body of the request into memory and replaces it with one that can be read again, which is required
+// to sign the body or send it more than once.
+func buffer(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.ContentLength = int64(len(body))
+	if len(body) == 0 {
+		req.Body, req.GetBody = http.NoBody, nil
+		return nil, nil
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return body, nil
+}
@@ -0,0 +1,196 @@
+package pia
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.URL.RawQuery, r.Header.Get("Authorization")+r.Header.Get("X-Api-Key"))
+	}))
+	defer server.Close()
+	tests := []struct {
+		name string
+		auth string
+		body string
+	}{
+		{
+			name: "none",
+			body: "a=1 ",
+		},
+		{
+			name: "basic",
+			auth: "type: basic\n  username: Aladdin\n  password: open sesame",
+			body: "a=1 Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==",
+		},
+		{
+			name: "bearer",
+			auth: "type: bearer\n  token: t0k3n",
+			body: "a=1 Bearer t0k3n",
+		},
+		{
+			name: "bearer with prefix",
+			auth: "type: bearer\n  token: t0k3n\n  prefix: Token",
+			body: "a=1 Token t0k3n",
+		},
+		{
+			name: "apikey header",
+			auth: "type: apikey\n  name: X-Api-Key\n  value: k3y",
+			body: "a=1 k3y",
+		},
+		{
+			name: "apikey query",
+			auth: "type: apikey\n  name: api_key\n  value: k3y\n  in: query",
+			body: "a=1&api_key=k3y ",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := fmt.Sprintf("method: GET\nurl:\n  target: %s\n  query:\n    a: 1\nauth:\n  %s", server.URL, test.auth)
+			tx, err := ParseTransaction("", strings.NewReader(src))
+			assert.Nil(t, err)
+			res, err := tx.Execute(ExecuteOptions{})
+			assert.Nil(t, err)
+			body, err := io.ReadAll(res.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, test.body, string(body))
+		})
+	}
+}
+
+func TestAuth_invalid(t *testing.T) {
+	for _, auth := range []string{
+		"type: magic",
+		"type: basic",
+		"type: apikey\n  name: key\n  in: cookie",
+		"type: hmac\n  secret: s\n  algorithm: md4",
+		"type: aws_sigv4\n  access_key: AKID",
+		"type: oauth2\n  token_url: https://example.com/token\n  grant: implicit",
+		"type: oauth2\n  grant: client_credentials",
+	} {
+		_, err := ParseTransaction("", strings.NewReader("auth:\n  "+auth))
+		assert.NotNil(t, err, auth)
+	}
+}
+
+func TestAuth_hmac(t *testing.T) {
+	auth := Auth{
+		Type:      "hmac",
+		Secret:    "s3cr3t",
+		Canonical: "{method} {path}?{query}\n{header:X-Date}\n{body_sha256}",
+		Header:    "X-Signature",
+		Format:    "HMAC {signature}",
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/users?b=2&a=1", strings.NewReader(`{"name":"pia"}`))
+	assert.Nil(t, err)
+	req.Header.Set("X-Date", "Mon, 02 Jan 2006 15:04:05 GMT")
+	assert.Nil(t, auth.authorize(req))
+
+	digest := sha256.Sum256([]byte(`{"name":"pia"}`))
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write([]byte("POST /users?b=2&a=1\nMon, 02 Jan 2006 15:04:05 GMT\n" + hex.EncodeToString(digest[:])))
+	assert.Equal(t, "HMAC "+hex.EncodeToString(mac.Sum(nil)), req.Header.Get("X-Signature"))
+	// The body must still be sent after having been signed.
+	body, err := io.ReadAll(req.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"pia"}`, string(body))
+
+	_, err = expand("{method", func(string) (string, bool) { return "", true })
+	assert.NotNil(t, err)
+	_, err = expand("{unknown}", func(string) (string, bool) { return "", false })
+	assert.NotNil(t, err)
+}
+
+func TestAuth_sigv4(t *testing.T) {
+	// The request and signature are those of the get-vanilla case of the AWS Signature Version 4 test suite.
+	auth := Auth{
+		Type:      "aws_sigv4",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:    "us-east-1",
+		Service:   "service",
+		now: func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, auth.authorize(req))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(
+		t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"),
+	)
+}
+
+func TestAuth_digest(t *testing.T) {
+	// The credentials, challenge and responses are those of the examples of RFC 7616.
+	tests := []struct {
+		algorithm string
+		response  string
+	}{
+		{
+			algorithm: "MD5",
+			response:  "8ca523f5e9506fed4657c9700eebdbec",
+		},
+		{
+			algorithm: "SHA-256",
+			response:  "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.algorithm, func(t *testing.T) {
+			var attempts int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				body, _ := io.ReadAll(r.Body)
+				params := authParams(strings.TrimPrefix(r.Header.Get("Authorization"), "Digest "))
+				if params["response"] != test.response || string(body) != "payload" {
+					w.Header().Add("WWW-Authenticate", `Basic realm="http-auth@example.org"`)
+					w.Header().Add("WWW-Authenticate", fmt.Sprintf(
+						`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=%s, `+
+							`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", `+
+							`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+						test.algorithm,
+					))
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				assert.Equal(t, "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", params["opaque"])
+				assert.Equal(t, "Mufasa", params["username"])
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+			tx := Transaction{
+				Method: http.MethodGet,
+				Body:   strings.NewReader("payload"),
+				Auth: Auth{
+					Type:     "digest",
+					Username: "Mufasa",
+					Password: "Circle of Life",
+					cnonce: func() string {
+						return "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+					},
+				},
+			}
+			tx.URL.Target = server.URL + "/dir/index.html"
+			res, err := tx.Execute(ExecuteOptions{})
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, 2, attempts)
+		})
+	}
+}
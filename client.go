@@ -0,0 +1,255 @@
+package pia
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ClientConfig configures the HTTP client used to execute a transaction. The zero value uses the defaults of
+// [http.DefaultClient].
+type ClientConfig struct {
+	// Timeout limits the total time of a request, including connecting, redirects and reading the response body.
+	Timeout time.Duration `yaml:"timeout"`
+	// ConnectTimeout limits the time spent establishing a connection.
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	// TLSTimeout limits the time spent on the TLS handshake.
+	TLSTimeout time.Duration `yaml:"tls_timeout"`
+	// Redirects is either "follow", which follows up to 10 redirects, "none", which returns the first response as is,
+	// or the maximum number of redirects to follow. Redirects are followed if empty.
+	Redirects string `yaml:"redirects"`
+	// Proxy is the URL of the proxy to send requests through. If empty, the proxy is taken from the environment.
+	Proxy string `yaml:"proxy"`
+	// CA is the path to a PEM encoded bundle of certificates which are trusted in addition to those of the system.
+	CA string `yaml:"ca"`
+	// Cert and Key are the paths to the PEM encoded certificate and private key presented to servers requiring mutual
+	// TLS.
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// InsecureSkipVerify turns off verification of the certificates presented by servers.
+	InsecureSkipVerify *bool `yaml:"insecure_skip_verify"`
+	// HTTPVersion is either "1.1", which only uses HTTP/1.1, or "2", which only uses HTTP/2. HTTP/2 is then also used
+	// for unencrypted connections, which requires the server to support it without upgrading. If empty, HTTP/2 is used
+	// whenever the server supports it.
+	HTTPVersion string `yaml:"http_version"`
+}
+
+// Merge returns a copy of c where every option set in o takes precedence.
+func (c ClientConfig) Merge(o ClientConfig) ClientConfig {
+	if o.Timeout != 0 {
+		c.Timeout = o.Timeout
+	}
+	if o.ConnectTimeout != 0 {
+		c.ConnectTimeout = o.ConnectTimeout
+	}
+	if o.TLSTimeout != 0 {
+		c.TLSTimeout = o.TLSTimeout
+	}
+	if o.Redirects != "" {
+		c.Redirects = o.Redirects
+	}
+	if o.Proxy != "" {
+		c.Proxy = o.Proxy
+	}
+	if o.CA != "" {
+		c.CA = o.CA
+	}
+	if o.Cert != "" || o.Key != "" {
+		c.Cert, c.Key = o.Cert, o.Key
+	}
+	if o.InsecureSkipVerify != nil {
+		c.InsecureSkipVerify = o.InsecureSkipVerify
+	}
+	if o.HTTPVersion != "" {
+		c.HTTPVersion = o.HTTPVersion
+	}
+	return c
+}
+
+// Client returns an [http.Client] configured accordingly. Relative paths are resolved against wd. The
+// [http.DefaultClient] is returned if no options are set. A new client is built on every call, use [pia.Clients] to
+// share the connections of clients configured alike.
+func (c ClientConfig) Client(wd string) (*http.Client, error) {
+	if c == (ClientConfig{}) {
+		return http.DefaultClient, nil
+	}
+	return c.client(wd)
+}
+
+func (c ClientConfig) client(wd string) (*http.Client, error) {
+	client := &http.Client{Timeout: c.Timeout}
+	switch c.Redirects {
+	case "", "follow":
+	case "none":
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	default:
+		n, err := strconv.Atoi(c.Redirects)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid redirects %q: expected follow, none or a number", c.Redirects)
+		}
+		client.CheckRedirect = func(_ *http.Request, via []*http.Request) error {
+			if len(via) > n {
+				return fmt.Errorf("stopped after %d redirects", n)
+			}
+			return nil
+		}
+	}
+	transport, err := c.transport(wd)
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = transport
+	return client, nil
+}
+
+func (c ClientConfig) transport(wd string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if c.ConnectTimeout != 0 {
+		transport.DialContext = (&net.Dialer{Timeout: c.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if c.TLSTimeout != 0 {
+		transport.TLSHandshakeTimeout = c.TLSTimeout
+	}
+	switch c.HTTPVersion {
+	case "":
+	case "1.1":
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP1(true)
+	case "2":
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("invalid http_version %q: expected 1.1 or 2", c.HTTPVersion)
+	}
+	// The TLS configuration of the default transport is not reused since it may carry protocols which contradict
+	// HTTPVersion.
+	cfg := &tls.Config{}
+	if c.CA != "" {
+		pem, err := os.ReadFile(join(wd, c.CA))
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CA)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.Cert != "" || c.Key != "" {
+		if c.Cert == "" || c.Key == "" {
+			return nil, errors.New("both cert and key must be given for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(join(wd, c.Cert), join(wd, c.Key))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.InsecureSkipVerify != nil {
+		cfg.InsecureSkipVerify = *c.InsecureSkipVerify
+	}
+	transport.TLSClientConfig = cfg
+	return transport, nil
+}
+
+// Abs returns a copy of c where the relative paths have been resolved against wd.
+func (c ClientConfig) Abs(wd string) ClientConfig {
+	for _, path := range []*string{&c.CA, &c.Cert, &c.Key} {
+		if *path != "" {
+			*path = filepath.Clean(join(wd, *path))
+		}
+	}
+	return c
+}
+
+// Clients holds the clients built for the transactions of a run or workspace, which allows the connections of a client
+// to be reused by every transaction configured alike. A client is built anew once the certificate files it was built
+// from have been modified. The zero value is ready to use, and Clients is safe for concurrent use.
+type Clients struct {
+	mu sync.Mutex
+	m  map[clientKey]cachedClient
+}
+
+// clientKey identifies a [pia.ClientConfig] whose relative paths have been resolved. InsecureSkipVerify is held by
+// value since configurations holding distinct pointers to the same value are configured alike.
+type clientKey struct {
+	config   ClientConfig
+	insecure string
+}
+
+type cachedClient struct {
+	client *http.Client
+	// files holds the modification times of the CA, Cert and Key files when the client was built.
+	files [3]time.Time
+}
+
+// Client returns the client configured according to cfg, see [pia.ClientConfig.Client].
+func (c *Clients) Client(cfg ClientConfig, wd string) (*http.Client, error) {
+	if cfg == (ClientConfig{}) {
+		return http.DefaultClient, nil
+	}
+	key := clientKey{config: cfg.Abs(wd)}
+	if key.config.InsecureSkipVerify != nil {
+		key.insecure = strconv.FormatBool(*key.config.InsecureSkipVerify)
+		key.config.InsecureSkipVerify = nil
+	}
+	var files [3]time.Time
+	for i, path := range []string{key.config.CA, key.config.Cert, key.config.Key} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			files[i] = info.ModTime()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.m[key]
+	if ok && cached.files == files {
+		return cached.client, nil
+	}
+	if ok {
+		cached.client.CloseIdleConnections()
+	}
+	client, err := cfg.client(wd)
+	if err != nil {
+		return nil, err
+	}
+	if c.m == nil {
+		c.m = make(map[clientKey]cachedClient)
+	}
+	c.m[key] = cachedClient{client: client, files: files}
+	return client, nil
+}
+
+// Close closes the idle connections of every client and forgets them. Clients may still be used after closing them.
+func (c *Clients) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cached := range c.m {
+		cached.client.CloseIdleConnections()
+	}
+	clear(c.m)
+}
@@ -0,0 +1,294 @@
+package pia_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/squeak"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientConfig_Merge(t *testing.T) {
+	yes, no := true, false
+	defaults := pia.ClientConfig{
+		Timeout:            5 * time.Second,
+		Redirects:          "none",
+		CA:                 "/ca.pem",
+		InsecureSkipVerify: &yes,
+	}
+	merged := defaults.Merge(pia.ClientConfig{
+		Timeout:            time.Second,
+		Proxy:              "http://localhost:3128",
+		InsecureSkipVerify: &no,
+	})
+	assert.Equal(t, pia.ClientConfig{
+		Timeout:            time.Second,
+		Redirects:          "none",
+		Proxy:              "http://localhost:3128",
+		CA:                 "/ca.pem",
+		InsecureSkipVerify: &no,
+	}, merged)
+}
+
+func TestClients_Client(t *testing.T) {
+	wd := t.TempDir()
+	yes, alsoYes := true, true
+	var clients pia.Clients
+	client, err := clients.Client(pia.ClientConfig{Timeout: time.Second, InsecureSkipVerify: &yes}, wd)
+	assert.Nil(t, err)
+	// Configurations which resolve to the same options share a client, and thereby its connections.
+	same, err := clients.Client(pia.ClientConfig{Timeout: time.Second, InsecureSkipVerify: &alsoYes}, wd)
+	assert.Nil(t, err)
+	assert.Same(t, client, same)
+	other, err := clients.Client(pia.ClientConfig{Timeout: 2 * time.Second, InsecureSkipVerify: &yes}, wd)
+	assert.Nil(t, err)
+	assert.NotSame(t, client, other)
+	zero, err := clients.Client(pia.ClientConfig{}, wd)
+	assert.Nil(t, err)
+	assert.Same(t, http.DefaultClient, zero)
+
+	// A client is built anew once a certificate file it was built from has been modified.
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	ca := filepath.Join(wd, "ca.pem")
+	write(t, ca, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+	cfg := pia.ClientConfig{CA: "ca.pem"}
+	client, err = clients.Client(cfg, wd)
+	assert.Nil(t, err)
+	same, err = clients.Client(cfg, wd)
+	assert.Nil(t, err)
+	assert.Same(t, client, same)
+	assert.Nil(t, os.Chtimes(ca, time.Time{}, time.Now().Add(time.Minute)))
+	other, err = clients.Client(cfg, wd)
+	assert.Nil(t, err)
+	assert.NotSame(t, client, other)
+
+	clients.Close()
+	after, err := clients.Client(cfg, wd)
+	assert.Nil(t, err)
+	assert.NotSame(t, other, after)
+}
+
+func TestTransaction_Execute_client(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect/{n}", func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		_, _ = fmt.Sscan(r.PathValue("n"), &n)
+		if n == 0 {
+			_, _ = io.WriteString(w, "arrived")
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/proto", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	})
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	server.StartTLS()
+	defer server.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "proxied "+r.URL.String())
+	}))
+	defer proxy.Close()
+
+	wd := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Nil(t, os.WriteFile(filepath.Join(wd, "ca.pem"), ca, 0644))
+
+	tests := []struct {
+		name     string
+		src      string
+		defaults pia.ClientConfig
+		body     string
+		status   int
+		err      bool
+	}{
+		{
+			name: "untrusted certificate",
+			src:  "url:\n  target: ${url}/redirect/0",
+			err:  true,
+		},
+		{
+			name:   "relative CA bundle",
+			src:    "url:\n  target: ${url}/redirect/0\nclient:\n  ca: ca.pem",
+			body:   "arrived",
+			status: http.StatusOK,
+		},
+		{
+			name:   "insecure skip verify",
+			src:    "url:\n  target: ${url}/redirect/0\nclient:\n  insecure_skip_verify: true",
+			body:   "arrived",
+			status: http.StatusOK,
+		},
+		{
+			name:     "workspace defaults",
+			src:      "url:\n  target: ${url}/redirect/3",
+			defaults: pia.ClientConfig{CA: filepath.Join(wd, "ca.pem")},
+			body:     "arrived",
+			status:   http.StatusOK,
+		},
+		{
+			name:     "overridden defaults",
+			src:      "url:\n  target: ${url}/redirect/3\nclient:\n  redirects: follow",
+			defaults: pia.ClientConfig{CA: filepath.Join(wd, "ca.pem"), Redirects: "none"},
+			body:     "arrived",
+			status:   http.StatusOK,
+		},
+		{
+			name:   "no redirects",
+			src:    "url:\n  target: ${url}/redirect/3\nclient:\n  ca: ca.pem\n  redirects: none",
+			body:   "<a href=\"/redirect/2\">Found</a>.\n\n",
+			status: http.StatusFound,
+		},
+		{
+			name:   "max redirects",
+			src:    "url:\n  target: ${url}/redirect/3\nclient:\n  ca: ca.pem\n  redirects: 3",
+			body:   "arrived",
+			status: http.StatusOK,
+		},
+		{
+			name: "too many redirects",
+			src:  "url:\n  target: ${url}/redirect/3\nclient:\n  ca: ca.pem\n  redirects: 2",
+			err:  true,
+		},
+		{
+			name: "timeout",
+			src:  "url:\n  target: ${url}/slow\nclient:\n  ca: ca.pem\n  timeout: 50ms",
+			err:  true,
+		},
+		{
+			name:   "http/1.1",
+			src:    "url:\n  target: ${url}/proto\nclient:\n  ca: ca.pem\n  http_version: 1.1",
+			body:   "HTTP/1.1",
+			status: http.StatusOK,
+		},
+		{
+			name:   "http/2",
+			src:    "url:\n  target: ${url}/proto\nclient:\n  ca: ca.pem\n  http_version: 2",
+			body:   "HTTP/2.0",
+			status: http.StatusOK,
+		},
+		{
+			name:   "proxy",
+			src:    "url:\n  target: http://example.com/path\nclient:\n  proxy: ${proxy}",
+			body:   "proxied http://example.com/path",
+			status: http.StatusOK,
+		},
+		{
+			name: "invalid redirects",
+			src:  "url:\n  target: ${url}/redirect/0\nclient:\n  redirects: sometimes",
+			err:  true,
+		},
+	}
+	resolver := pia.MapResolver{"url": server.URL, "proxy": proxy.URL}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(wd, "tx.yaml")
+			assert.Nil(t, os.WriteFile(path, []byte(test.src), 0644))
+			tx, err := pia.ReadTransaction(resolver, path, pia.WithClientDefaults(test.defaults))
+			assert.Nil(t, err)
+			res, err := tx.Execute(pia.ExecuteOptions{})
+			if test.err {
+				assert.NotNil(t, err)
+				return
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, test.status, res.StatusCode)
+			assert.Equal(t, test.body, string(body))
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTransaction_Execute_options(t *testing.T) {
+	tx, err := pia.ParseTransaction(t.TempDir(), strings.NewReader(`
+method: GET
+url:
+  target: https://example.com/users
+hooks:
+  after:
+    inline: |
+      print(response.status_code == 418);
+`))
+	assert.Nil(t, err)
+
+	t.Run("transport", func(t *testing.T) {
+		var out bytes.Buffer
+		res, err := tx.Execute(pia.ExecuteOptions{
+			Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "https://example.com/users", req.URL.String())
+				return &http.Response{
+					StatusCode: http.StatusTeapot,
+					Body:       io.NopCloser(strings.NewReader("in memory")),
+					Request:    req,
+				}, nil
+			}),
+			Interpreter: squeak.NewInterpreter("", &out),
+		})
+		assert.Nil(t, err)
+		body, err := io.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "in memory", string(body))
+		assert.Equal(t, "true", out.String())
+	})
+
+	t.Run("client", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.Host)
+		}))
+		defer server.Close()
+		client := server.Client()
+		target := server.Listener.Addr().String()
+		client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, target)
+		}
+		client.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+		res, err := tx.Execute(pia.ExecuteOptions{Client: client})
+		assert.Nil(t, err)
+		body, err := io.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "example.com", string(body))
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := tx.Execute(pia.ExecuteOptions{
+			Context: ctx,
+			Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, req.Context().Err()
+			}),
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
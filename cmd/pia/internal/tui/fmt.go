@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -40,3 +41,28 @@ func ResponseFormatter(w io.Writer, res *http.Response) error {
 	}
 	return nil
 }
+
+// JSONResponseFormatter writes the response as a single JSON document containing the status, headers and body of the
+// response. It is intended for consumption by other programs rather than humans.
+func JSONResponseFormatter(w io.Writer, res *http.Response) error {
+	doc := struct {
+		Status     string              `json:"status"`
+		StatusCode int                 `json:"status_code"`
+		Headers    map[string][]string `json:"headers"`
+		Body       string              `json:"body"`
+	}{
+		Status:     res.Status,
+		StatusCode: res.StatusCode,
+		Headers:    res.Header,
+	}
+	if res.Body != nil {
+		raw, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		doc.Body = string(raw)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
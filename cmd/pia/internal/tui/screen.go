@@ -3,12 +3,13 @@ package tui
 import (
 	"bytes"
 	"fmt"
+	"github.com/crookdc/pia"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"golang.design/x/clipboard"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -44,8 +45,17 @@ func newConsole(log *bytes.Buffer) *console {
 }
 
 type console struct {
-	log  *bytes.Buffer
-	text *tview.TextView
+	// mu guards log, which is written to by hooks while requests are executed in the background.
+	mu     sync.Mutex
+	log    *bytes.Buffer
+	text   *tview.TextView
+	redact func(string) string
+}
+
+func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.log.Write(p)
 }
 
 func (c *console) root() tview.Primitive {
@@ -53,7 +63,13 @@ func (c *console) root() tview.Primitive {
 }
 
 func (c *console) enter() {
-	c.text.SetText(c.log.String())
+	c.mu.Lock()
+	text := c.log.String()
+	c.mu.Unlock()
+	if c.redact != nil {
+		text = c.redact(text)
+	}
+	c.text.SetText(text)
 }
 
 func newFinder(wd string) *finder {
@@ -125,8 +141,7 @@ func (f *finder) toggle(node *tview.TreeNode, path string) {
 		panic(err)
 	}
 	for _, file := range files {
-		yml := strings.HasSuffix(file.Name(), ".yml") || strings.HasSuffix(file.Name(), ".yaml")
-		if !yml && !file.IsDir() {
+		if !pia.IsTransactionFile(file.Name()) && !file.IsDir() {
 			continue
 		}
 		n := tview.NewTreeNode(file.Name()).
@@ -188,3 +203,155 @@ func (h *history) push(e entry) {
 	}
 	h.transactions[0] = &e
 }
+
+func newSessions() *sessions {
+	s := &sessions{
+		list:  tview.NewList(),
+		input: tview.NewInputField().SetLabel("Switch to session: "),
+	}
+	s.flex = tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(s.list, 0, 1, true).
+		AddItem(s.input, 1, 0, false)
+	s.list.SetInputCapture(s.keys)
+	s.input.SetDoneFunc(s.done)
+	return s
+}
+
+type sessions struct {
+	flex           *tview.Flex
+	list           *tview.List
+	input          *tview.InputField
+	names          []string
+	focusCallback  func(tview.Primitive)
+	switchCallback func(string)
+	clearCallback  func(string)
+}
+
+func (s *sessions) root() tview.Primitive {
+	return s.flex
+}
+
+func (s *sessions) enter(active string, names []string) {
+	s.names = names
+	s.list.Clear()
+	for _, name := range names {
+		text := name
+		if name == active {
+			text += " (active)"
+		}
+		s.list.AddItem(text, "", 0, func() {
+			if s.switchCallback == nil {
+				return
+			}
+			s.switchCallback(name)
+		})
+	}
+}
+
+func (s *sessions) keys(ev *tcell.EventKey) *tcell.EventKey {
+	switch ev.Rune() {
+	case 'd':
+		if s.clearCallback == nil || len(s.names) == 0 {
+			return nil
+		}
+		s.clearCallback(s.names[s.list.GetCurrentItem()])
+		return nil
+	case 'n':
+		if s.focusCallback == nil {
+			return ev
+		}
+		s.focusCallback(s.input)
+		return nil
+	default:
+		return ev
+	}
+}
+
+func (s *sessions) done(key tcell.Key) {
+	name := s.input.GetText()
+	s.input.SetText("")
+	if s.focusCallback != nil {
+		s.focusCallback(s.list)
+	}
+	if key != tcell.KeyEnter || name == "" || s.switchCallback == nil {
+		return
+	}
+	s.switchCallback(name)
+}
+
+func newEnvironments() *environments {
+	return &environments{
+		list: tview.NewList(),
+	}
+}
+
+type environments struct {
+	list           *tview.List
+	switchCallback func(string)
+}
+
+func (e *environments) root() tview.Primitive {
+	return e.list
+}
+
+func (e *environments) enter(active string, names []string) {
+	e.list.Clear()
+	// The empty name denotes using the properties of the base environment alone.
+	for _, name := range append([]string{""}, names...) {
+		text := name
+		if name == "" {
+			text = pia.BaseEnvironment
+		}
+		if name == active {
+			text += " (active)"
+		}
+		e.list.AddItem(text, "", 0, func() {
+			if e.switchCallback == nil {
+				return
+			}
+			e.switchCallback(name)
+		})
+	}
+}
+
+func newUnlock() *unlock {
+	u := &unlock{
+		input: tview.NewInputField().SetLabel("Vault passphrase: ").SetMaskCharacter('*'),
+		text:  tview.NewTextView(),
+	}
+	u.flex = tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(u.input, 1, 0, true).
+		AddItem(u.text, 0, 1, false)
+	u.input.SetDoneFunc(u.done)
+	return u
+}
+
+type unlock struct {
+	flex           *tview.Flex
+	input          *tview.InputField
+	text           *tview.TextView
+	unlockCallback func(string) error
+	doneCallback   func()
+}
+
+func (u *unlock) root() tview.Primitive {
+	return u.flex
+}
+
+func (u *unlock) done(key tcell.Key) {
+	passphrase := u.input.GetText()
+	u.input.SetText("")
+	if key != tcell.KeyEnter || u.unlockCallback == nil {
+		return
+	}
+	if err := u.unlockCallback(passphrase); err != nil {
+		u.text.SetText(err.Error())
+		return
+	}
+	u.text.SetText("")
+	if u.doneCallback != nil {
+		u.doneCallback()
+	}
+}
@@ -2,7 +2,11 @@ package tui
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/cmd/pia/internal/workspace"
 	"github.com/crookdc/pia/squeak"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -10,17 +14,23 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
 type App struct {
-	resolver pia.KeyResolver
+	workspace *workspace.Workspace
 	*tview.Application
-	pages   *tview.Pages
-	console *console
-	content *content
-	finder  *finder
-	history *history
+	pages    *tview.Pages
+	console  *console
+	content  *content
+	finder   *finder
+	history  *history
+	sessions *sessions
+	envs     *environments
+	unlock   *unlock
+	// cancel cancels the request being executed, it is nil unless a request is being executed.
+	cancel context.CancelFunc
 }
 
 func (a *App) view(path string) {
@@ -29,38 +39,172 @@ func (a *App) view(path string) {
 		panic(err)
 	}
 	defer tx.Close()
-	src, err := io.ReadAll(pia.WrapReader(a.resolver, tx))
-	if err != nil {
-		panic(err)
+	resolver := a.workspace.Resolver()
+	// Values memoized while reading another transaction must not leak into this one, just like for ReadTransaction.
+	if r, ok := resolver.(pia.Resetter); ok {
+		r.Reset()
+	}
+	if r, ok := resolver.(pia.Relocatable); ok {
+		resolver = r.Relocate(filepath.Dir(path))
+	}
+	src, err := io.ReadAll(pia.WrapReader(resolver, tx, pia.WithSource(path), pia.WithCollect()))
+	var missing pia.InterpolationErrors
+	if errors.As(err, &missing) {
+		// The unresolvable substitution points are left untouched, which still makes the file worth displaying.
+		src = append([]byte(missing.Error()+"\n\n"), src...)
+	} else if err != nil {
+		a.display(err.Error())
+		return
 	}
-	a.display(string(src))
+	a.display(a.workspace.Redact(string(src)))
 }
 
+// execute executes the transaction found at path in the background, the request can be cancelled using <CTRL-X> until
+// its response has been displayed. Only one transaction is executed at a time.
 func (a *App) execute(path string) {
-	cfg, err := os.ReadFile(path)
-	if err != nil {
-		panic(err)
+	if a.cancel != nil {
+		a.display("A request is already executing, press <CTRL-X> to cancel it.")
+		return
 	}
-	tx, err := pia.ParseTransaction(filepath.Dir(path), pia.WrapReader(a.resolver, bytes.NewReader(cfg)))
+	tx, err := pia.ReadTransaction(a.workspace.Resolver(), path, a.workspace.TransactionOpts()...)
 	if err != nil {
-		panic(err)
+		a.display(err.Error())
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.display(fmt.Sprintf("Executing %s %s\n\nPress <CTRL-X> to cancel.", tx.Method, tx.URL.Target))
+	// The workspace is only touched by the event loop, which is why everything the request needs from it is captured
+	// before executing it in the background. Switching or clearing sessions is refused until the request is done, which
+	// keeps the captured session from being saved under the name of another session.
+	exec := execution{
+		interpreter: a.workspace.Interpreter(tx.WD, a.console),
+		clients:     a.workspace.Clients,
+		session:     a.workspace.Session,
+		name:        a.workspace.SessionName,
+		store:       a.workspace.Sessions,
+	}
+	go func() {
+		defer cancel()
+		text, err := exec.send(ctx, tx)
+		a.QueueUpdateDraw(func() {
+			a.cancel = nil
+			if err != nil {
+				a.display(a.workspace.Redact(err.Error()))
+				return
+			}
+			// Secrets may be echoed by the server or printed by hooks and must not linger in the history or console.
+			text = a.workspace.Redact(text)
+			a.history.push(entry{
+				method:    tx.Method,
+				endpoint:  tx.URL.Target,
+				timestamp: time.Now(),
+				text:      text,
+			})
+			a.display(text)
+		})
+	}()
+}
+
+// execution holds what is needed to execute a transaction outside the event loop of the application.
+type execution struct {
+	interpreter *squeak.Interpreter
+	clients     *pia.Clients
+	session     *pia.Session
+	name        string
+	store       pia.SessionStore
+}
+
+// send executes the transaction and returns its formatted response. It is called outside the event loop of the
+// application and must therefore not touch any of its primitives. The session is saved whether the transaction
+// succeeds or not, since its hooks may have changed the session before failing.
+func (e execution) send(ctx context.Context, tx *pia.Transaction) (string, error) {
+	res, err := tx.Execute(pia.ExecuteOptions{
+		Context:     ctx,
+		Interpreter: e.interpreter,
+		Clients:     e.clients,
+		Session:     e.session,
+	})
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if e.session.Dirty() {
+		if serr := e.store.Save(e.name, e.session); serr != nil {
+			err = errors.Join(err, serr)
+		}
 	}
-	res, err := tx.Execute(squeak.NewInterpreter(tx.WD, a.console.log))
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	buf := bytes.NewBufferString("")
 	if err := ResponseFormatter(buf, res); err != nil {
-		panic(err)
+		return "", err
 	}
-	text := buf.String()
-	a.history.push(entry{
-		method:    tx.Method,
-		endpoint:  tx.URL.Target,
-		timestamp: time.Now(),
-		text:      text,
-	})
-	a.display(text)
+	return buf.String(), nil
+}
+
+func (a *App) openSessions() {
+	names, err := a.workspace.Sessions.List()
+	if err != nil {
+		a.display(err.Error())
+		return
+	}
+	if !slices.Contains(names, a.workspace.SessionName) {
+		// The active session is not listed until it has been saved, which happens the first time it is changed.
+		names = append(names, a.workspace.SessionName)
+		slices.Sort(names)
+	}
+	a.sessions.enter(a.workspace.SessionName, names)
+	a.pages.SwitchToPage("sessions")
+}
+
+// busy reports whether a request is executing, in which case the message is displayed.
+func (a *App) busy(message string) bool {
+	if a.cancel == nil {
+		return false
+	}
+	a.display(message + " Press <CTRL-X> to cancel the executing request.")
+	return true
+}
+
+func (a *App) switchSession(name string) {
+	if a.busy("Sessions cannot be switched while a request is executing.") {
+		return
+	}
+	if err := a.workspace.SwitchSession(name); err != nil {
+		a.display(err.Error())
+		return
+	}
+	a.openSessions()
+}
+
+func (a *App) clearSession(name string) {
+	if a.busy("Sessions cannot be cleared while a request is executing.") {
+		return
+	}
+	if err := a.workspace.ClearSession(name); err != nil {
+		a.display(err.Error())
+		return
+	}
+	a.openSessions()
+}
+
+func (a *App) openEnvironments() {
+	names, err := a.workspace.Environments.List()
+	if err != nil {
+		a.display(err.Error())
+		return
+	}
+	a.envs.enter(a.workspace.EnvName, names)
+	a.pages.SwitchToPage("environments")
+}
+
+func (a *App) switchEnvironment(name string) {
+	if err := a.workspace.SwitchEnvironment(name); err != nil {
+		a.display(err.Error())
+		return
+	}
+	a.openEnvironments()
 }
 
 func (a *App) display(text string) {
@@ -73,6 +217,16 @@ func (a *App) input(ev *tcell.EventKey) *tcell.EventKey {
 		a.pages.SwitchToPage("dashboard")
 		return nil
 	}
+	if ev.Key() == tcell.KeyCtrlX {
+		if a.cancel != nil {
+			a.cancel()
+		}
+		return nil
+	}
+	if _, ok := a.GetFocus().(*tview.InputField); ok {
+		// Runes typed into an input field should never be interpreted as navigation.
+		return ev
+	}
 	switch ev.Rune() {
 	case 'h':
 		a.history.enter()
@@ -81,6 +235,12 @@ func (a *App) input(ev *tcell.EventKey) *tcell.EventKey {
 	case 'f':
 		a.pages.SwitchToPage("finder")
 		return nil
+	case 's':
+		a.openSessions()
+		return nil
+	case 'e':
+		a.openEnvironments()
+		return nil
 	case 'c':
 		a.console.enter()
 		if a.pages.HasPage("console") {
@@ -94,7 +254,7 @@ func (a *App) input(ev *tcell.EventKey) *tcell.EventKey {
 	}
 }
 
-func Run(wd string, props map[string]string) error {
+func Run(ws *workspace.Workspace) error {
 	if err := clipboard.Init(); err != nil {
 		return err
 	}
@@ -103,20 +263,29 @@ func Run(wd string, props map[string]string) error {
 		pages:       tview.NewPages(),
 		console:     newConsole(bytes.NewBufferString("")),
 		content:     newContent(),
-		finder:      newFinder(wd),
+		finder:      newFinder(ws.WD),
 		history:     newHistory(128),
-		resolver: pia.DelegatingKeyResolver{
-			Delegates: map[string]pia.KeyResolver{
-				"env":   pia.EnvironmentResolver{},
-				"props": pia.MapResolver(props),
-			},
-		},
+		sessions:    newSessions(),
+		envs:        newEnvironments(),
+		unlock:      newUnlock(),
+		workspace:   ws,
 	}
 	app.history.viewCallback = func(e *entry) {
 		app.display(e.text)
 	}
 	app.finder.executeCallback = app.execute
 	app.finder.viewCallback = app.view
+	app.envs.switchCallback = app.switchEnvironment
+	app.console.redact = ws.Redact
+	app.unlock.unlockCallback = ws.UnlockVault
+	app.unlock.doneCallback = func() {
+		app.pages.SwitchToPage("dashboard")
+	}
+	app.sessions.switchCallback = app.switchSession
+	app.sessions.clearCallback = app.clearSession
+	app.sessions.focusCallback = func(p tview.Primitive) {
+		app.SetFocus(p)
+	}
 	app.pages.AddPage("dashboard", tview.NewTextView().SetText(`
 	
 	pia - the postman alternative for technical people. 
@@ -128,7 +297,14 @@ func Run(wd string, props map[string]string) error {
 		v - view file contents after preprocessing
 			y - copy output to clipboard
 	h - open history
+	e - open environments
+		<ENTER> - switch to selected environment
+	s - open sessions
+		<ENTER> - switch to selected session
+		d - clear selected session
+		n - switch to a new session by name
 	c - toggle console
+	<CTRL-X> - cancel the executing request
 
 	<ESC> brings you back here.
 
@@ -137,6 +313,13 @@ func Run(wd string, props map[string]string) error {
 	app.pages.AddPage("finder", app.finder.root(), true, false)
 	app.pages.AddPage("content", app.content.root(), true, false)
 	app.pages.AddPage("history", app.history.root(), true, false)
+	app.pages.AddPage("sessions", app.sessions.root(), true, false)
+	app.pages.AddPage("environments", app.envs.root(), true, false)
+	app.pages.AddPage("unlock", app.unlock.root(), true, false)
+	if ws.VaultLocked() {
+		// The passphrase is prompted for once when starting, <ESC> skips unlocking and leaves the vault locked.
+		app.pages.SwitchToPage("unlock")
+	}
 	app.SetInputCapture(app.input)
 	return app.SetRoot(app.pages, true).Run()
 }
@@ -0,0 +1,52 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crookdc/pia"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Settings are the options of a workspace which are read from .pia/config.yml within its working directory.
+type Settings struct {
+	// DefaultSource is the context key used to resolve keys which carry no prefix, such as "${token}".
+	DefaultSource string `yaml:"default_source"`
+	// MemoizeGenerators makes repeated references to the same generated key, such as "${gen:uuid}", resolve to the
+	// same value within a transaction.
+	MemoizeGenerators bool `yaml:"memoize_generators"`
+	// Interpolation is either "text", which interpolates the raw text of transactions before parsing them, or
+	// "structured", which parses transactions before interpolating each of their values. Text is used if empty.
+	Interpolation string `yaml:"interpolation"`
+	// Client configures the HTTP client used by every transaction of the workspace, transactions may override each of
+	// its options. Relative paths are resolved against the working directory of the workspace.
+	Client pia.ClientConfig `yaml:"client"`
+}
+
+// ReadSettings reads the settings of the workspace rooted in wd. A workspace without a configuration file has empty
+// settings.
+func ReadSettings(wd string) (Settings, error) {
+	var settings Settings
+	path := filepath.Join(wd, ".pia", "config.yml")
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	defer f.Close()
+	if err := yaml.NewDecoder(f).Decode(&settings); err != nil && !errors.Is(err, io.EOF) {
+		return settings, fmt.Errorf("%s: %w", path, err)
+	}
+	switch settings.Interpolation {
+	case "", "text", "structured":
+	default:
+		return settings, fmt.Errorf("%s: unrecognized interpolation: %s", path, settings.Interpolation)
+	}
+	settings.Client = settings.Client.Abs(wd)
+	return settings, nil
+}
@@ -0,0 +1,222 @@
+// Package workspace assembles the state shared by every transaction executed from a working directory, regardless of
+// whether the transactions are executed from the TUI or from the command line.
+package workspace
+
+import (
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/squeak"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// DefaultSession is the name of the session used when no other session has been selected.
+	DefaultSession = "default"
+	// SessionPassphraseEnv is the name of the environment variable holding the passphrase used to encrypt secret
+	// session values at rest.
+	SessionPassphraseEnv = "PIA_SESSION_PASSPHRASE"
+	// VaultPassphraseEnv is the name of the environment variable holding the passphrase used to open the vault.
+	VaultPassphraseEnv = "PIA_VAULT_PASSPHRASE"
+)
+
+// Config describes how to open a [workspace.Workspace].
+type Config struct {
+	WD string
+	// Env is the name of the environment to activate. If empty, only the properties of the base environment are used.
+	Env string
+	// Props contains properties which take precedence over the properties of any environment.
+	Props map[string]string
+	// Session is the name of the session to activate, [workspace.DefaultSession] is used if empty.
+	Session string
+}
+
+// Open returns a [workspace.Workspace] rooted in the configured working directory with the configured session loaded
+// from disk.
+func Open(cfg Config) (*Workspace, error) {
+	settings, err := ReadSettings(cfg.WD)
+	if err != nil {
+		return nil, err
+	}
+	ws := &Workspace{
+		WD:           cfg.WD,
+		Settings:     settings,
+		Environments: pia.Environments{Dir: filepath.Join(cfg.WD, pia.EnvironmentsDir)},
+		Sessions:     Sessions(cfg.WD),
+		Clients:      &pia.Clients{},
+		overrides:    cfg.Props,
+		generator:    &pia.GeneratorResolver{Memoize: settings.MemoizeGenerators},
+	}
+	if err := ws.SwitchEnvironment(cfg.Env); err != nil {
+		return nil, err
+	}
+	if passphrase := os.Getenv(VaultPassphraseEnv); passphrase != "" && ws.VaultLocked() {
+		if err := ws.UnlockVault(passphrase); err != nil {
+			return nil, err
+		}
+	}
+	name := cfg.Session
+	if name == "" {
+		name = DefaultSession
+	}
+	if err := ws.SwitchSession(name); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// Sessions returns the [pia.SessionStore] holding the sessions saved within the workspace rooted in wd.
+func Sessions(wd string) pia.SessionStore {
+	return pia.SessionStore{
+		Dir:        filepath.Join(wd, ".pia", "sessions"),
+		Passphrase: os.Getenv(SessionPassphraseEnv),
+	}
+}
+
+// VaultPath returns the path of the file holding the vault of the workspace rooted in wd.
+func VaultPath(wd string) string {
+	return filepath.Join(wd, ".pia", "vault.json")
+}
+
+// Workspace is the state shared by the transactions executed within a working directory.
+type Workspace struct {
+	WD           string
+	Settings     Settings
+	Environments pia.Environments
+	// EnvName is the name of the currently active environment.
+	EnvName string
+	// Props contains the properties of the active environment merged with the properties given when opening the
+	// workspace.
+	Props     map[string]string
+	overrides map[string]string
+	Sessions  pia.SessionStore
+	// SessionName is the name of the currently active session.
+	SessionName string
+	Session     *pia.Session
+	// Vault is the vault of the workspace, or nil if the workspace has no vault or it has not been unlocked.
+	Vault *pia.Vault
+	// Clients holds the HTTP clients of the transactions executed within the workspace.
+	Clients   *pia.Clients
+	generator *pia.GeneratorResolver
+}
+
+// Resolver returns the [pia.KeyResolver] used to interpolate transactions executed within the workspace.
+func (w *Workspace) Resolver() pia.KeyResolver {
+	var vault pia.KeyResolver = lockedVault{}
+	if w.Vault != nil {
+		vault = w.Vault
+	}
+	return pia.DelegatingKeyResolver{
+		Delegates: map[string]pia.KeyResolver{
+			"env":     pia.EnvironmentResolver{},
+			"props":   pia.MapResolver(w.Props),
+			"session": w.Session,
+			"gen":     w.generator,
+			"file":    pia.FileResolver{Dir: w.WD},
+			"data":    pia.DocumentResolver{Dir: w.WD},
+			"vault":   vault,
+		},
+		Default: w.Settings.DefaultSource,
+	}
+}
+
+// TransactionOpts returns the options used to read transactions executed within the workspace.
+func (w *Workspace) TransactionOpts() []pia.TransactionOpt {
+	opts := []pia.TransactionOpt{pia.WithClientDefaults(w.Settings.Client)}
+	if w.Settings.Interpolation == "structured" {
+		opts = append(opts, pia.WithStructuredInterpolation())
+	}
+	return opts
+}
+
+// Redact replaces every secret value known to the workspace within text with asterisks. This includes every value of
+// the vault as well as the session values marked as secret.
+func (w *Workspace) Redact(text string) string {
+	return pia.Redact(w.Resolver(), text)
+}
+
+// VaultLocked reports whether the workspace has a vault which has not been unlocked.
+func (w *Workspace) VaultLocked() bool {
+	if w.Vault != nil {
+		return false
+	}
+	_, err := os.Stat(VaultPath(w.WD))
+	return err == nil
+}
+
+// UnlockVault opens the vault of the workspace using the passphrase, which makes its values resolvable by transactions
+// interpolated after unlocking.
+func (w *Workspace) UnlockVault(passphrase string) error {
+	vault, err := pia.OpenVault(VaultPath(w.WD), passphrase)
+	if err != nil {
+		return err
+	}
+	w.Vault = vault
+	return nil
+}
+
+// Interpreter returns a [squeak.Interpreter] for executing the hooks of transactions residing in wd. The interpreter is
+// given access to the active session of the workspace.
+func (w *Workspace) Interpreter(wd string, out io.Writer) *squeak.Interpreter {
+	in := squeak.NewInterpreter(wd, out)
+	in.Declare("session", w.Session)
+	return in
+}
+
+// SwitchEnvironment makes the named environment the active environment. Transactions interpolated after switching
+// resolve the props context key using the properties of the new environment.
+func (w *Workspace) SwitchEnvironment(name string) error {
+	props, err := w.Environments.Load(name)
+	if err != nil {
+		return err
+	}
+	maps.Copy(props, w.overrides)
+	w.EnvName = name
+	w.Props = props
+	return nil
+}
+
+// SwitchSession loads the named session from disk and makes it the active session. Any changes made to the previously
+// active session are saved before switching.
+func (w *Workspace) SwitchSession(name string) error {
+	if w.Session != nil {
+		if err := w.SaveSession(); err != nil {
+			return err
+		}
+	}
+	session, err := w.Sessions.Load(name)
+	if err != nil {
+		return err
+	}
+	w.SessionName = name
+	w.Session = session
+	return nil
+}
+
+// SaveSession writes the active session to disk if it has been changed since it was loaded or last saved.
+func (w *Workspace) SaveSession() error {
+	if !w.Session.Dirty() {
+		return nil
+	}
+	return w.Sessions.Save(w.SessionName, w.Session)
+}
+
+// ClearSession removes the named session from disk. Clearing the active session also removes every value from it.
+func (w *Workspace) ClearSession(name string) error {
+	if err := w.Sessions.Clear(name); err != nil {
+		return err
+	}
+	if name == w.SessionName {
+		w.Session = pia.NewSession()
+	}
+	return nil
+}
+
+// lockedVault stands in for the vault of the workspace until it has been unlocked.
+type lockedVault struct{}
+
+func (lockedVault) Resolve(k string) (string, error) {
+	return "", fmt.Errorf("%w: %s cannot be resolved since the vault is locked", pia.ErrKeyNotFound, k)
+}
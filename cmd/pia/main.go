@@ -1,48 +1,42 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"github.com/crookdc/pia/cmd/pia/internal/tui"
+	"github.com/crookdc/pia/cmd/pia/internal/workspace"
+	"github.com/crookdc/pia/properties"
 	"log"
 	"os"
-	"strings"
 )
 
 func main() {
+	session := flag.String("session", workspace.DefaultSession, "name of the session to activate")
+	env := flag.String("env", "", "name of the environment to activate")
 	flag.Parse()
 	wd, err := os.Getwd()
 	if err != nil {
 		log.Fatalln(err)
 	}
+	switch flag.Arg(0) {
+	case "run":
+		os.Exit(run(wd, flag.Args()[1:]))
+	case "session":
+		os.Exit(sessions(wd, flag.Args()[1:]))
+	case "vault":
+		os.Exit(vault(wd, flag.Args()[1:]))
+	}
 	props := make(map[string]string)
 	if flag.NArg() > 0 {
-		props, err = properties(flag.Arg(0))
+		props, err = properties.ReadFile(flag.Arg(0))
 		if err != nil {
 			log.Fatalln(err)
 		}
 	}
-	if err := tui.Run(wd, props); err != nil {
-		log.Fatalln(err)
-	}
-}
-
-func properties(path string) (map[string]string, error) {
-	props := make(map[string]string)
-	src, err := os.ReadFile(path)
+	ws, err := workspace.Open(workspace.Config{WD: wd, Env: *env, Props: props, Session: *session})
 	if err != nil {
-		return nil, err
+		log.Fatalln(err)
 	}
-	scn := bufio.NewScanner(strings.NewReader(string(src)))
-	for scn.Scan() {
-		line := scn.Text()
-		segments := strings.SplitN(line, "=", 2)
-		if len(segments) != 2 {
-			continue
-		}
-		props[segments[0]] = strings.TrimSpace(
-			strings.Trim(segments[1], "\""),
-		)
+	if err := tui.Run(ws); err != nil {
+		log.Fatalln(err)
 	}
-	return props, nil
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/cmd/pia/internal/tui"
+	"github.com/crookdc/pia/cmd/pia/internal/workspace"
+	"github.com/crookdc/pia/properties"
+	"github.com/crookdc/pia/report"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// run executes the transactions found at the path given in args without starting the TUI and returns the exit code of
+// the process. A path to a directory executes the entire collection of transactions found within it.
+func run(wd string, args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pia run [flags] <file.yml|dir>")
+		fs.PrintDefaults()
+	}
+	propsPath := fs.String("props", "", "property file whose properties take precedence over those of the environment")
+	env := fs.String("env", "", "name of the environment to activate")
+	format := fs.String("format", "text", "output format of responses, either text or json")
+	quiet := fs.Bool("quiet", false, "do not print responses")
+	session := fs.String("session", workspace.DefaultSession, "name of the session to activate")
+	reportFormat := fs.String("report", "", "write a report of the run as either junit, tap or json")
+	reportPath := fs.String("report-file", "", "file to write the report to, defaults to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	var formatter func(io.Writer, *http.Response) error
+	switch *format {
+	case "text":
+		formatter = tui.ResponseFormatter
+	case "json":
+		formatter = tui.JSONResponseFormatter
+	default:
+		fmt.Fprintf(os.Stderr, "unrecognized output format: %s\n", *format)
+		return 2
+	}
+	var reporter report.Reporter
+	if *reportFormat != "" {
+		var ok bool
+		reporter, ok = report.Reporters[*reportFormat]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unrecognized report format: %s\n", *reportFormat)
+			return 2
+		}
+		if *reportPath == "" {
+			// The report is written to standard output and would be corrupted by any responses written alongside it.
+			*quiet = true
+		}
+	}
+	props := make(map[string]string)
+	if *propsPath != "" {
+		var err error
+		props, err = properties.ReadFile(*propsPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	path := fs.Arg(0)
+	root := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+	ws, err := workspace.Open(workspace.Config{WD: wd, Env: *env, Props: props, Session: *session})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// An interrupt cancels the request in flight and stops the run, the transactions executed so far are still
+	// summarized and reported.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	runner := pia.Runner{
+		Context:     ctx,
+		Resolver:    ws.Resolver(),
+		Interpreter: ws.Interpreter(root, os.Stderr),
+		Session:     ws.Session,
+		Options:     ws.TransactionOpts(),
+		Callback: func(res pia.Result) {
+			if err := ws.SaveSession(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if res.Response == nil || *quiet {
+				return
+			}
+			if err := formatter(os.Stdout, res.Response); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		},
+	}
+	summary, err := runner.Run(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	summarize(os.Stderr, summary)
+	if reporter != nil {
+		if err := write(reporter, *reportPath, summary); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if ctx.Err() != nil || summary.Count(pia.Passed) != len(summary.Results) {
+		return 1
+	}
+	return 0
+}
+
+// write writes the report produced by reporter to the file found at path, or to standard output if path is empty.
+func write(reporter report.Reporter, path string, summary *pia.Summary) error {
+	if path == "" {
+		return reporter(os.Stdout, summary)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := reporter(f, summary); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// summarize writes a human-readable summary of the provided [pia.Summary] to w.
+func summarize(w io.Writer, summary *pia.Summary) {
+	fmt.Fprintln(w)
+	for _, res := range summary.Results {
+		line := fmt.Sprintf("%-8s %s (%s)", strings.ToUpper(res.Status.String()), res.Path, res.Duration.Round(time.Millisecond))
+		if res.Err != nil {
+			line += ": " + res.Err.Error()
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(
+		w,
+		"\n%d transactions, %d passed, %d failed, %d errored in %s\n",
+		len(summary.Results),
+		summary.Count(pia.Passed),
+		summary.Count(pia.Failed),
+		summary.Count(pia.Errored),
+		summary.Duration.Round(time.Millisecond),
+	)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/crookdc/pia/cmd/pia/internal/workspace"
+	"os"
+)
+
+// sessions manages the sessions saved within the workspace rooted in wd and returns the exit code of the process.
+func sessions(wd string, args []string) int {
+	fs := flag.NewFlagSet("session", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `Usage: pia session <command> [name]
+
+Commands:
+  list          list the names of all saved sessions
+  show <name>   print the values stored in a session, secret values are redacted
+  clear <name>  remove a session and all of its values`)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	store := workspace.Sessions(wd)
+	switch cmd := fs.Arg(0); {
+	case cmd == "list" && fs.NArg() == 1:
+		names, err := store.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case cmd == "show" && fs.NArg() == 2:
+		session, err := store.Load(fs.Arg(1))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, k := range session.Keys() {
+			v, err := session.Resolve(k)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			if session.Secret(k) {
+				v = "********"
+			}
+			fmt.Printf("%s=%s\n", k, v)
+		}
+	case cmd == "clear" && fs.NArg() == 2:
+		if err := store.Clear(fs.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/cmd/pia/internal/workspace"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+// vault manages the vault of the workspace rooted in wd and returns the exit code of the process.
+func vault(wd string, args []string) int {
+	fs := flag.NewFlagSet("vault", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: pia vault <command> [key] [value]
+
+Commands:
+  init               create a new empty vault
+  list               list the keys of all entries
+  get <key>          print the value of an entry
+  set <key> [value]  store an entry, the value is prompted for if omitted
+  delete <key>       remove an entry
+  rotate             re-encrypt the vault using a new passphrase
+
+The passphrase is read from %s if set, otherwise it is prompted for.
+`, workspace.VaultPassphraseEnv)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	path := workspace.VaultPath(wd)
+	if cmd := fs.Arg(0); cmd == "init" && fs.NArg() == 1 {
+		passphrase := os.Getenv(workspace.VaultPassphraseEnv)
+		if passphrase == "" {
+			var err error
+			passphrase, err = newPassphrase("Passphrase")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		if _, err := pia.InitVault(path, passphrase); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	passphrase := os.Getenv(workspace.VaultPassphraseEnv)
+	if passphrase == "" {
+		var err error
+		passphrase, err = prompt("Passphrase")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	v, err := pia.OpenVault(path, passphrase)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch cmd := fs.Arg(0); {
+	case cmd == "list" && fs.NArg() == 1:
+		for _, k := range v.Keys() {
+			fmt.Println(k)
+		}
+	case cmd == "get" && fs.NArg() == 2:
+		value, err := v.Resolve(fs.Arg(1))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(value)
+	case cmd == "set" && (fs.NArg() == 2 || fs.NArg() == 3):
+		value := fs.Arg(2)
+		if fs.NArg() == 2 {
+			value, err = prompt("Value")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		v.Set(fs.Arg(1), value)
+		if err := v.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case cmd == "delete" && fs.NArg() == 2:
+		v.Delete(fs.Arg(1))
+		if err := v.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case cmd == "rotate" && fs.NArg() == 1:
+		passphrase, err := newPassphrase("New passphrase")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := v.Rotate(passphrase); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
+
+// prompt reads a line from the terminal without echoing it.
+func prompt(label string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cannot prompt for %s since standard input is not a terminal", label)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	value, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(value), err
+}
+
+// newPassphrase prompts for a passphrase twice to guard against typing mistakes.
+func newPassphrase(label string) (string, error) {
+	passphrase, err := prompt(label)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("passphrase must not be empty")
+	}
+	confirmation, err := prompt("Repeat " + strings.ToLower(label))
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirmation {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
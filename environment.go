@@ -0,0 +1,95 @@
+package pia
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crookdc/pia/properties"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// BaseEnvironment is the name of the environment whose properties are inherited by every other environment.
+const BaseEnvironment = "base"
+
+// EnvironmentsDir is the name of the directory within a workspace holding its [pia.Environments].
+const EnvironmentsDir = "environments"
+
+var ErrEnvironmentNotFound = errors.New("environment not found")
+
+// Environments is a directory of property files, each of which defines a named environment such as dev, staging or
+// production. Any format supported by the properties package can be used, and the name of an environment is the name
+// of its file without the extension. Every environment inherits the properties of the [pia.BaseEnvironment], if there
+// is one, and may override any of them.
+type Environments struct {
+	Dir string
+}
+
+// List returns the names of every environment in lexical order. The [pia.BaseEnvironment] is not included since it is
+// not meant to be used on its own.
+func (e Environments) List() ([]string, error) {
+	files, err := e.files()
+	if err != nil {
+		return nil, err
+	}
+	delete(files, BaseEnvironment)
+	return slices.Sorted(maps.Keys(files)), nil
+}
+
+// Load returns the properties of the named environment merged on top of the properties of the [pia.BaseEnvironment].
+// Loading an empty name returns the properties of the [pia.BaseEnvironment] alone.
+func (e Environments) Load(name string) (map[string]string, error) {
+	files, err := e.files()
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]string)
+	if base, ok := files[BaseEnvironment]; ok {
+		if err := merge(props, base); err != nil {
+			return nil, err
+		}
+	}
+	if name == "" || name == BaseEnvironment {
+		return props, nil
+	}
+	path, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrEnvironmentNotFound, name)
+	}
+	if err := merge(props, path); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// files returns the paths of the environment files keyed by the name of the environment they define.
+func (e Environments) files() (map[string]string, error) {
+	files := make(map[string]string)
+	entries, err := os.ReadDir(e.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if entry.IsDir() || name == "" || !properties.Supported(entry.Name()) {
+			continue
+		}
+		files[name] = filepath.Join(e.Dir, entry.Name())
+	}
+	return files, nil
+}
+
+func merge(dst map[string]string, path string) error {
+	props, err := properties.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	maps.Copy(dst, props)
+	return nil
+}
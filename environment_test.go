@@ -0,0 +1,60 @@
+package pia_test
+
+import (
+	"github.com/crookdc/pia"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvironments(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "base.properties"), "host=localhost\nuser=pia\n")
+	write(t, filepath.Join(dir, "staging.properties"), "host=staging.example.com\n")
+	write(t, filepath.Join(dir, "production.yml"), "host: example.com\nuser: admin\n")
+	write(t, filepath.Join(dir, "local.env"), "export host=127.0.0.1\n")
+	write(t, filepath.Join(dir, "notes.txt"), "")
+	envs := pia.Environments{Dir: dir}
+
+	names, err := envs.List()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"local", "production", "staging"}, names)
+
+	tests := []struct {
+		name  string
+		props map[string]string
+		err   error
+	}{
+		{
+			name:  "",
+			props: map[string]string{"host": "localhost", "user": "pia"},
+		},
+		{
+			name:  "staging",
+			props: map[string]string{"host": "staging.example.com", "user": "pia"},
+		},
+		{
+			name:  "production",
+			props: map[string]string{"host": "example.com", "user": "admin"},
+		},
+		{
+			name:  "local",
+			props: map[string]string{"host": "127.0.0.1", "user": "pia"},
+		},
+		{
+			name: "development",
+			err:  pia.ErrEnvironmentNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			props, err := envs.Load(test.name)
+			assert.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.props, props)
+		})
+	}
+
+	props, err := pia.Environments{Dir: filepath.Join(dir, "missing")}.Load("")
+	assert.Nil(t, err)
+	assert.Empty(t, props)
+}
@@ -0,0 +1,111 @@
+package pia
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// expression is the parsed form of the text found between "${" and "}" in an interpolated stream. An expression is a
+// chain of keys separated by '|' which are resolved in order until one of them is found, optionally followed by ":-"
+// and a default value that is used if none of the keys can be resolved. The expression may end with any number of
+// filters, also separated by '|', which are applied to the resolved value. For example,
+// "env:TOKEN|props:token:-none | upper".
+//
+// Since keys and filters share the separator, a trailing segment is only a filter if it names a registered filter,
+// such as "json", and a key otherwise. A key named like a filter must therefore not be the last key of a chain.
+type expression struct {
+	keys     []string
+	fallback *string
+	filters  []Filter
+	// unknown is the trailing segment which looks like the name of a filter but is not registered as one. It is taken
+	// to be a key, but is reported as a possibly misspelled filter if none of the keys can be resolved.
+	unknown string
+}
+
+func parseExpression(src string, filters Filters) expression {
+	var expr expression
+	segments := strings.Split(src, "|")
+	// Trailing segments naming a filter are filters rather than keys, although the first segment is always considered
+	// a key.
+	n := len(segments)
+	for n > 1 {
+		name := strings.TrimSpace(segments[n-1])
+		f, ok := filters[name]
+		if !ok {
+			if isFilterName(name) {
+				expr.unknown = name
+			}
+			break
+		}
+		expr.filters = append([]Filter{f}, expr.filters...)
+		n--
+	}
+	keys, fallback, ok := strings.Cut(strings.Join(segments[:n], "|"), ":-")
+	if ok {
+		if len(expr.filters) > 0 {
+			// The whitespace separating the default value from the first filter is not part of the default value.
+			fallback = strings.TrimRight(fallback, " \t")
+		}
+		expr.fallback = &fallback
+	}
+	for _, k := range strings.Split(keys, "|") {
+		expr.keys = append(expr.keys, strings.TrimSpace(k))
+	}
+	return expr
+}
+
+// resolve returns the filtered value of the first key in the chain that the resolver can resolve. Only errors wrapping
+// [pia.ErrKeyNotFound] cause the next key in the chain to be tried, any other error is returned immediately.
+func (e expression) resolve(resolver KeyResolver) (string, error) {
+	v, err := e.value(resolver)
+	if err != nil && e.unknown != "" && errors.Is(err, ErrKeyNotFound) {
+		return "", fmt.Errorf("%w, or is %s a misspelled filter? (%w)", err, e.unknown, ErrUnknownFilter)
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, f := range e.filters {
+		v, err = f(v)
+		if err != nil {
+			return "", err
+		}
+	}
+	return v, nil
+}
+
+func (e expression) value(resolver KeyResolver) (string, error) {
+	var err error
+	for _, k := range e.keys {
+		var v string
+		v, err = resolver.Resolve(k)
+		if err == nil {
+			return v, nil
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return "", err
+		}
+	}
+	if e.fallback != nil {
+		return *e.fallback, nil
+	}
+	if len(e.keys) > 1 {
+		return "", fmt.Errorf("%w: none of %s could be resolved", ErrKeyNotFound, strings.Join(e.keys, ", "))
+	}
+	return "", err
+}
+
+// isFilterName reports whether s is a bare name consisting only of letters, digits, '_' and '-', which is what the
+// name of a filter looks like.
+func isFilterName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package pia
+
+import (
+	"fmt"
+	"github.com/crookdc/pia/internal/yamlnode"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"strings"
+)
+
+// Field is a single named value of [pia.Fields].
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Fields is an ordered collection of named values in which a name may occur any number of times, such as the query
+// parameters or headers of a request. In a transaction configuration, Fields are written as a mapping whose values are
+// either a single value or a list of values. The fields are kept in the order in which they are written.
+//
+//	query:
+//	  id:
+//	    - 1
+//	    - 2
+//	  name: pia
+type Fields []Field
+
+// Get returns the first value of the named field, or an empty string if there is no such field.
+func (f Fields) Get(name string) string {
+	for _, field := range f {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Values returns every value of the named field in order.
+func (f Fields) Values(name string) []string {
+	var values []string
+	for _, field := range f {
+		if field.Name == name {
+			values = append(values, field.Value)
+		}
+	}
+	return values
+}
+
+func (f *Fields) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of names to values", node.Line)
+	}
+	*f = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, value := node.Content[i].Value, yamlnode.Resolve(node.Content[i+1])
+		values := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			values = value.Content
+		}
+		for _, v := range values {
+			var s string
+			if err := v.Decode(&s); err != nil {
+				return fmt.Errorf("line %d: value of %s must be a string or a list of strings", v.Line, name)
+			}
+			*f = append(*f, Field{Name: name, Value: s})
+		}
+	}
+	return nil
+}
+
+// encode returns the fields URL encoded as a query string, in order.
+func (f Fields) encode() string {
+	var sb strings.Builder
+	for i, field := range f {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(url.QueryEscape(field.Name))
+		sb.WriteByte('=')
+		sb.WriteString(url.QueryEscape(field.Value))
+	}
+	return sb.String()
+}
+
+// setQuery sets the query parameter name of u to value, replacing any values it already has while keeping the order of
+// every other query parameter.
+func setQuery(u *url.URL, name, value string) {
+	var params []string
+	if u.RawQuery != "" {
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			key, _, _ := strings.Cut(param, "=")
+			if k, err := url.QueryUnescape(key); err == nil && k == name {
+				continue
+			}
+			params = append(params, param)
+		}
+	}
+	params = append(params, Fields{{Name: name, Value: value}}.encode())
+	u.RawQuery = strings.Join(params, "&")
+}
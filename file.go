@@ -0,0 +1,128 @@
+package pia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crookdc/pia/internal/yamlnode"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileResolver is a [pia.KeyResolver] which resolves keys as paths to files and returns their contents. Relative paths
+// are resolved against Dir. A single trailing line break is removed from the contents, which allows files such as
+// tokens written by other tools to be substituted into headers as is.
+type FileResolver struct {
+	Dir string
+}
+
+// Resolve implements the [pia.KeyResolver] interface.
+func (f FileResolver) Resolve(k string) (string, error) {
+	src, err := os.ReadFile(join(f.Dir, k))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: file %s does not exist", ErrKeyNotFound, k)
+	}
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimSuffix(string(src), "\n")
+	return strings.TrimSuffix(v, "\r"), nil
+}
+
+// Relocate implements the [pia.Relocatable] interface.
+func (f FileResolver) Relocate(wd string) KeyResolver {
+	return FileResolver{Dir: wd}
+}
+
+// DocumentResolver is a [pia.KeyResolver] which resolves values found within JSON or YAML documents. Keys consist of the
+// path to the document, resolved against Dir if relative, followed by '#' and a JSON pointer as defined by RFC 6901 to
+// the value within the document, such as "users.json#/0/email". Scalars are returned using the textual representation
+// they have in the document while mappings and sequences are returned encoded as JSON. Omitting the pointer returns the
+// entire document.
+type DocumentResolver struct {
+	Dir string
+}
+
+// Resolve implements the [pia.KeyResolver] interface.
+func (d DocumentResolver) Resolve(k string) (string, error) {
+	path, pointer, _ := strings.Cut(k, "#")
+	f, err := os.Open(join(d.Dir, path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: document %s does not exist", ErrKeyNotFound, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var doc yaml.Node
+	if err := yaml.NewDecoder(f).Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("invalid document %s: %w", path, err)
+	}
+	node := &doc
+	if node.Kind == yaml.DocumentNode {
+		node = node.Content[0]
+	}
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return "", fmt.Errorf("invalid pointer %s: must start with '/'", pointer)
+	}
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		node = child(node, token)
+		if node == nil {
+			return "", fmt.Errorf("%w: %s is not in document %s", ErrKeyNotFound, pointer, path)
+		}
+	}
+	node = yamlnode.Resolve(node)
+	if node.Kind == yaml.ScalarNode {
+		if node.Tag == "!!null" {
+			return "", nil
+		}
+		return node.Value, nil
+	}
+	var v any
+	if err := node.Decode(&v); err != nil {
+		return "", err
+	}
+	src, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("value at %s in document %s cannot be encoded as JSON: %w", pointer, path, err)
+	}
+	return string(src), nil
+}
+
+// Relocate implements the [pia.Relocatable] interface.
+func (d DocumentResolver) Relocate(wd string) KeyResolver {
+	return DocumentResolver{Dir: wd}
+}
+
+// child returns the value of the mapping key or the sequence item addressed by token, or nil if there is none.
+func child(node *yaml.Node, token string) *yaml.Node {
+	node = yamlnode.Resolve(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(node.Content) {
+			return nil
+		}
+		return node.Content[i]
+	}
+	return nil
+}
+
+func join(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
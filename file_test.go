@@ -0,0 +1,141 @@
+package pia_test
+
+import (
+	"github.com/crookdc/pia"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileResolver_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "certs", "token.txt"), "abc123\n")
+	write(t, filepath.Join(dir, "multiline.txt"), "first\nsecond\n\n")
+
+	tests := []struct {
+		key   string
+		value string
+		err   error
+	}{
+		{
+			key:   "./certs/token.txt",
+			value: "abc123",
+		},
+		{
+			key:   filepath.Join(dir, "certs", "token.txt"),
+			value: "abc123",
+		},
+		{
+			key:   "multiline.txt",
+			value: "first\nsecond\n",
+		},
+		{
+			key: "missing.txt",
+			err: pia.ErrKeyNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			value, err := pia.FileResolver{Dir: dir}.Resolve(test.key)
+			assert.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.value, value)
+		})
+	}
+}
+
+func TestDocumentResolver_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "users.json"), `[
+  {"email": "pia@example.com", "age": 3, "roles": ["admin", "user"], "a/b": "slash", "m~n": "tilde"},
+  {"email": null}
+]`)
+	write(t, filepath.Join(dir, "fixtures", "config.yml"), `
+defaults: &defaults
+  region: eu-north-1
+service:
+  <<: *defaults
+  name: pia
+`)
+
+	tests := []struct {
+		key   string
+		value string
+		err   error
+	}{
+		{
+			key:   "users.json#/0/email",
+			value: "pia@example.com",
+		},
+		{
+			key:   "users.json#/0/age",
+			value: "3",
+		},
+		{
+			key:   "users.json#/0/roles",
+			value: `["admin","user"]`,
+		},
+		{
+			key:   "users.json#/0/roles/1",
+			value: "user",
+		},
+		{
+			key:   "users.json#/0/a~1b",
+			value: "slash",
+		},
+		{
+			key:   "users.json#/0/m~0n",
+			value: "tilde",
+		},
+		{
+			key:   "users.json#/1/email",
+			value: "",
+		},
+		{
+			key:   "fixtures/config.yml#/service/name",
+			value: "pia",
+		},
+		{
+			key:   "fixtures/config.yml#/defaults",
+			value: `{"region":"eu-north-1"}`,
+		},
+		{
+			key: "users.json#/2/email",
+			err: pia.ErrKeyNotFound,
+		},
+		{
+			key: "users.json#/0/missing",
+			err: pia.ErrKeyNotFound,
+		},
+		{
+			key: "missing.json#/0",
+			err: pia.ErrKeyNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			value, err := pia.DocumentResolver{Dir: dir}.Resolve(test.key)
+			assert.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.value, value)
+		})
+	}
+}
+
+func TestReadTransaction_relocatesResolvers(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "users", "token.txt"), "abc123\n")
+	write(t, filepath.Join(dir, "users", "list.yml"), `
+method: GET
+url:
+  target: https://example.com/users
+headers:
+  Authorization: Bearer ${file:token.txt}
+`)
+	resolver := pia.DelegatingKeyResolver{
+		Delegates: map[string]pia.KeyResolver{
+			"file": pia.FileResolver{Dir: dir},
+		},
+	}
+	tx, err := pia.ReadTransaction(resolver, filepath.Join(dir, "users", "list.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer abc123", tx.Headers.Get("Authorization"))
+}
@@ -0,0 +1,66 @@
+package pia
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/url"
+	"strings"
+)
+
+// Filter transforms a resolved value before it is substituted into an interpolated stream. Filters are applied by
+// appending "| name" to a substitution point, such as "${props:password | json}", and several filters can be chained
+// in which case they are applied from left to right.
+type Filter func(string) (string, error)
+
+// Filters is a registry of [pia.Filter] values keyed by the name used to apply them.
+type Filters map[string]Filter
+
+// DefaultFilters returns a new registry containing the built-in filters:
+//
+//   - base64 encodes the value using standard base64 encoding.
+//   - urlencode escapes the value so that it can be placed in a URL query.
+//   - json escapes the value so that it can be placed within a JSON string, the surrounding quotes are not added.
+//   - upper and lower changes the case of the value.
+//   - trim removes leading and trailing whitespace from the value.
+//   - sha256 replaces the value with the hex encoded SHA-256 digest of it.
+func DefaultFilters() Filters {
+	return maps.Clone(builtinFilters)
+}
+
+var builtinFilters = Filters{
+	"base64": func(s string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(s)), nil
+	},
+	"urlencode": func(s string) (string, error) {
+		return url.QueryEscape(s), nil
+	},
+	"json": func(s string) (string, error) {
+		buf := bytes.NewBuffer(nil)
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(s); err != nil {
+			return "", err
+		}
+		// The encoder terminates each value with a newline and wraps strings in quotes, neither of which is wanted since
+		// the value is meant to be placed within an existing JSON string.
+		escaped := strings.TrimSuffix(buf.String(), "\n")
+		return escaped[1 : len(escaped)-1], nil
+	},
+	"upper": func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	},
+	"lower": func(s string) (string, error) {
+		return strings.ToLower(s), nil
+	},
+	"trim": func(s string) (string, error) {
+		return strings.TrimSpace(s), nil
+	},
+	"sha256": func(s string) (string, error) {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:]), nil
+	},
+}
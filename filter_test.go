@@ -0,0 +1,31 @@
+package pia_test
+
+import (
+	"github.com/crookdc/pia"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefaultFilters(t *testing.T) {
+	tests := []struct {
+		filter   string
+		input    string
+		expected string
+	}{
+		{filter: "base64", input: "user:pass", expected: "dXNlcjpwYXNz"},
+		{filter: "urlencode", input: "a b&c=d/e", expected: "a+b%26c%3Dd%2Fe"},
+		{filter: "json", input: "say \"hi\"\n<tab>\t\\", expected: `say \"hi\"\n<tab>\t\\`},
+		{filter: "upper", input: "pia", expected: "PIA"},
+		{filter: "lower", input: "PIA", expected: "pia"},
+		{filter: "trim", input: " \tpia\n", expected: "pia"},
+		{filter: "sha256", input: "pia", expected: "cce6630a4894a148982e2822d7b7197dd5c8df7f29b9181e43b03716c85fd8e9"},
+	}
+	filters := pia.DefaultFilters()
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			actual, err := filters[test.filter](test.input)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
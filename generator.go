@@ -0,0 +1,166 @@
+package pia
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// layouts contains the named time layouts accepted by the now generator of [pia.GeneratorResolver].
+var layouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+const alphanumerics = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// GeneratorResolver is a [pia.KeyResolver] which generates a new value each time a key is resolved. Arguments are
+// separated from the name of the generator by ':'. The following generators are supported:
+//
+//   - uuid generates a random version 4 UUID.
+//   - now returns the current time formatted using RFC 3339. A layout may be given as argument, either as the name of
+//     one of the layouts defined by the time package, such as "now:RFC1123", or as a Go time layout, such as
+//     "now:2006-01-02".
+//   - unix and unix_ms return the current Unix time in seconds and milliseconds respectively.
+//   - random_int:min:max returns a random integer within the inclusive range [min, max]. The bounds may also be written
+//     as random_int:[min,max], which is required for a negative min when the key is interpolated.
+//   - random_string:n returns a random alphanumeric string of length n.
+type GeneratorResolver struct {
+	// Memoize makes repeated references to the same key resolve to the same value until [pia.GeneratorResolver.Reset]
+	// is called.
+	Memoize bool
+	// Now returns the current time. If nil, [time.Now] is used.
+	Now func() time.Time
+
+	mu   sync.Mutex
+	memo map[string]string
+}
+
+// Resolve implements the [pia.KeyResolver] interface.
+func (g *GeneratorResolver) Resolve(k string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if v, ok := g.memo[k]; ok {
+		return v, nil
+	}
+	v, err := g.generate(k)
+	if err != nil {
+		return "", err
+	}
+	if g.Memoize {
+		if g.memo == nil {
+			g.memo = make(map[string]string)
+		}
+		g.memo[k] = v
+	}
+	return v, nil
+}
+
+// Reset forgets every memoized value.
+func (g *GeneratorResolver) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	clear(g.memo)
+}
+
+func (g *GeneratorResolver) generate(k string) (string, error) {
+	name, args, _ := strings.Cut(k, ":")
+	switch name {
+	case "uuid":
+		return uuid()
+	case "now":
+		layout := time.RFC3339
+		if args != "" {
+			layout = args
+			if named, ok := layouts[args]; ok {
+				layout = named
+			}
+		}
+		return g.now().Format(layout), nil
+	case "unix":
+		return strconv.FormatInt(g.now().Unix(), 10), nil
+	case "unix_ms":
+		return strconv.FormatInt(g.now().UnixMilli(), 10), nil
+	case "random_int":
+		// A negative minimum cannot follow the name directly since ":-" separates the default value of an
+		// expression, the bounds are then written as an interval instead.
+		lo, hi, ok := strings.Cut(args, ":")
+		if strings.HasPrefix(args, "[") && strings.HasSuffix(args, "]") {
+			lo, hi, ok = strings.Cut(args[1:len(args)-1], ",")
+		}
+		if !ok {
+			return "", fmt.Errorf("invalid generator %s: expected random_int:min:max or random_int:[min,max]", k)
+		}
+		minimum, err := strconv.ParseInt(lo, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid generator %s: %w", k, err)
+		}
+		maximum, err := strconv.ParseInt(hi, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid generator %s: %w", k, err)
+		}
+		if minimum > maximum {
+			return "", fmt.Errorf("invalid generator %s: min is greater than max", k)
+		}
+		// The size of the range is computed using big.Int since it overflows an int64 for extreme bounds.
+		size := new(big.Int).Sub(big.NewInt(maximum), big.NewInt(minimum))
+		n, err := rand.Int(rand.Reader, size.Add(size, big.NewInt(1)))
+		if err != nil {
+			return "", err
+		}
+		return n.Add(n, big.NewInt(minimum)).String(), nil
+	case "random_string":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid generator %s: expected random_string:n", k)
+		}
+		return randomString(n)
+	default:
+		return "", fmt.Errorf("%w: %s is not a generator", ErrKeyNotFound, name)
+	}
+}
+
+func (g *GeneratorResolver) now() time.Time {
+	if g.Now == nil {
+		return time.Now()
+	}
+	return g.Now()
+}
+
+func uuid() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	size := big.NewInt(int64(len(alphanumerics)))
+	for i := range b {
+		j, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphanumerics[j.Int64()]
+	}
+	return string(b), nil
+}
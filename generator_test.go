@@ -0,0 +1,131 @@
+package pia_test
+
+import (
+	"github.com/crookdc/pia"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeneratorResolver_Resolve(t *testing.T) {
+	now := time.Date(2025, time.June, 14, 9, 30, 15, 500_000_000, time.UTC)
+	t.Run("deterministic generators", func(t *testing.T) {
+		tests := []struct {
+			key   string
+			value string
+			err   error
+		}{
+			{
+				key:   "now",
+				value: "2025-06-14T09:30:15Z",
+			},
+			{
+				key:   "now:RFC1123",
+				value: "Sat, 14 Jun 2025 09:30:15 UTC",
+			},
+			{
+				key:   "now:2006-01-02",
+				value: "2025-06-14",
+			},
+			{
+				key:   "unix",
+				value: "1749893415",
+			},
+			{
+				key:   "unix_ms",
+				value: "1749893415500",
+			},
+			{
+				key:   "random_int:5:5",
+				value: "5",
+			},
+			{
+				key:   "random_int:[-5,-5]",
+				value: "-5",
+			},
+			{
+				key:   "random_string:0",
+				value: "",
+			},
+			{
+				key: "unknown",
+				err: pia.ErrKeyNotFound,
+			},
+		}
+		for _, test := range tests {
+			t.Run(test.key, func(t *testing.T) {
+				g := &pia.GeneratorResolver{Now: func() time.Time { return now }}
+				value, err := g.Resolve(test.key)
+				assert.ErrorIs(t, err, test.err)
+				assert.Equal(t, test.value, value)
+			})
+		}
+	})
+	t.Run("uuid", func(t *testing.T) {
+		g := &pia.GeneratorResolver{}
+		value, err := g.Resolve("uuid")
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), value)
+		other, err := g.Resolve("uuid")
+		assert.NoError(t, err)
+		assert.NotEqual(t, value, other)
+	})
+	t.Run("random_int", func(t *testing.T) {
+		g := &pia.GeneratorResolver{}
+		for range 100 {
+			value, err := g.Resolve("random_int:-3:3")
+			assert.NoError(t, err)
+			n, err := strconv.Atoi(value)
+			assert.NoError(t, err)
+			assert.GreaterOrEqual(t, n, -3)
+			assert.LessOrEqual(t, n, 3)
+		}
+	})
+	t.Run("random_int with extreme bounds", func(t *testing.T) {
+		g := &pia.GeneratorResolver{}
+		value, err := g.Resolve("random_int:[-9223372036854775808,9223372036854775807]")
+		assert.NoError(t, err)
+		_, err = strconv.ParseInt(value, 10, 64)
+		assert.NoError(t, err)
+	})
+	t.Run("random_int with a negative min when interpolated", func(t *testing.T) {
+		resolver := pia.DelegatingKeyResolver{Delegates: map[string]pia.KeyResolver{"gen": &pia.GeneratorResolver{}}}
+		value, err := io.ReadAll(pia.WrapReader(resolver, strings.NewReader("${gen:random_int:[-5,-5]}")))
+		assert.NoError(t, err)
+		assert.Equal(t, "-5", string(value))
+	})
+	t.Run("random_string", func(t *testing.T) {
+		g := &pia.GeneratorResolver{}
+		value, err := g.Resolve("random_string:16")
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[A-Za-z0-9]{16}$`), value)
+	})
+	t.Run("invalid arguments", func(t *testing.T) {
+		g := &pia.GeneratorResolver{}
+		for _, key := range []string{
+			"random_int", "random_int:a:3", "random_int:3:1", "random_int:[1:3]", "random_string", "random_string:-1",
+		} {
+			_, err := g.Resolve(key)
+			assert.Error(t, err, key)
+			assert.NotErrorIs(t, err, pia.ErrKeyNotFound, key)
+		}
+	})
+	t.Run("memoize", func(t *testing.T) {
+		g := &pia.GeneratorResolver{Memoize: true}
+		first, err := g.Resolve("uuid")
+		assert.NoError(t, err)
+		second, err := g.Resolve("uuid")
+		assert.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		d := pia.DelegatingKeyResolver{Delegates: map[string]pia.KeyResolver{"gen": g}}
+		d.Reset()
+		third, err := d.Resolve("gen:uuid")
+		assert.NoError(t, err)
+		assert.NotEqual(t, first, third)
+	})
+}
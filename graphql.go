@@ -0,0 +1,74 @@
+package pia
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/crookdc/pia/squeak"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+// graphql is a GraphQL request body in its textual YAML state.
+type graphql struct {
+	Query string `yaml:"query"`
+	// File is the path of a file containing the query, it is used in place of Query.
+	File          string    `yaml:"file"`
+	Variables     yaml.Node `yaml:"variables"`
+	OperationName string    `yaml:"operationName"`
+}
+
+// reader returns a reader of the body of a GraphQL request sent over HTTP using JSON.
+func (g *graphql) reader(wd string) (io.Reader, error) {
+	query := g.Query
+	if g.File != "" {
+		if query != "" {
+			return nil, errors.New("graphql body cannot have both a query and a file")
+		}
+		src, err := os.ReadFile(join(wd, g.File))
+		if err != nil {
+			return nil, err
+		}
+		query = string(src)
+	}
+	if query == "" {
+		return nil, errors.New("graphql body requires a query or a file")
+	}
+	body := struct {
+		Query         string          `json:"query"`
+		OperationName string          `json:"operationName,omitempty"`
+		Variables     json.RawMessage `json:"variables,omitempty"`
+	}{
+		Query:         query,
+		OperationName: g.OperationName,
+	}
+	if g.Variables.Kind != 0 {
+		variables, err := marshalNode(&g.Variables)
+		if err != nil {
+			return nil, err
+		}
+		body.Variables = variables
+	}
+	src, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(src), nil
+}
+
+// graphqlErrors returns the errors listed in the GraphQL response body, or nil if there are none or if the body is not
+// a GraphQL response.
+func graphqlErrors(body []byte) squeak.Object {
+	var res struct {
+		Errors json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || len(res.Errors) == 0 {
+		return nil
+	}
+	var builder squeak.Builder
+	if err := json.Unmarshal(res.Errors, &builder); err != nil {
+		return nil
+	}
+	return builder.Object()
+}
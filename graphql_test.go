@@ -0,0 +1,75 @@
+package pia_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/squeak"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransaction_Execute_graphql(t *testing.T) {
+	var contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		_, _ = io.WriteString(w, `{"data":{"user":null},"errors":[{"message":"user not found","path":["user"]}]}`)
+	}))
+	defer server.Close()
+
+	wd := t.TempDir()
+	query := "query User($id: ID!) {\n  user(id: $id) {\n    name\n  }\n}\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(wd, "user.graphql"), []byte(query), 0644))
+	path := filepath.Join(wd, "user.yml")
+	assert.Nil(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+method: POST
+url:
+  target: %s
+body:
+  graphql:
+    file: user.graphql
+    operationName: User
+    variables:
+      id: ${id}
+hooks:
+  after:
+    inline: |
+      print(response.graphql_errors.length());
+      print(response.graphql_errors[0].message);
+`, server.URL)), 0644))
+
+	tx, err := pia.ReadTransaction(pia.MapResolver{"id": "42"}, path)
+	assert.Nil(t, err)
+	var out bytes.Buffer
+	_, err = tx.Execute(pia.ExecuteOptions{Interpreter: squeak.NewInterpreter(wd, &out)})
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(
+		t,
+		`{"query":"query User($id: ID!) {\n  user(id: $id) {\n    name\n  }\n}\n","operationName":"User","variables":{"id":42}}`,
+		body,
+	)
+	assert.Equal(t, "1.user not found", out.String())
+}
+
+func TestParseTransaction_graphql(t *testing.T) {
+	for _, src := range []string{
+		"body:\n  graphql:\n    variables:\n      id: 1",
+		"body:\n  graphql:\n    query: '{ me { name } }'\n    file: me.graphql",
+		"body:\n  graphql:\n    file: missing.graphql",
+	} {
+		tx, err := pia.ParseTransaction(t.TempDir(), strings.NewReader(src))
+		if err == nil {
+			_, err = tx.Request()
+		}
+		assert.NotNil(t, err, src)
+	}
+}
@@ -0,0 +1,82 @@
+// Package yamlnode walks YAML documents decoded into [yaml.Node] the way they would be decoded into Go values, which
+// is shared by pia and its properties package.
+package yamlnode
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+)
+
+// Error is returned for a node which cannot be walked. Line is the line on which the node is written.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Resolve returns the node referred to by node if it is an alias, or node itself otherwise.
+func Resolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// Pair is a key of a mapping along with its value.
+type Pair struct {
+	Key   *yaml.Node
+	Value *yaml.Node
+}
+
+// MappingPairs returns the keys and values of the mapping node in the order in which they are written. The pairs of
+// mappings merged into the node using "<<" take the place of the merge key, except for keys which the node defines
+// itself. When a sequence of mappings is merged, the first mapping defining a key takes precedence.
+func MappingPairs(node *yaml.Node) ([]Pair, error) {
+	explicit := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if key.Kind != yaml.ScalarNode {
+			return nil, Error{Line: key.Line, Msg: "keys must be scalars"}
+		}
+		if key.ShortTag() != "!!merge" {
+			explicit[key.Value] = true
+		}
+	}
+	var pairs []Pair
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.ShortTag() != "!!merge" {
+			if !seen[key.Value] {
+				seen[key.Value] = true
+				pairs = append(pairs, Pair{Key: key, Value: value})
+			}
+			continue
+		}
+		value = Resolve(value)
+		merged := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			merged = value.Content
+		}
+		for _, m := range merged {
+			m = Resolve(m)
+			if m.Kind != yaml.MappingNode {
+				return nil, Error{Line: m.Line, Msg: "only mappings can be merged"}
+			}
+			inherited, err := MappingPairs(m)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range inherited {
+				if !explicit[p.Key.Value] && !seen[p.Key.Value] {
+					seen[p.Key.Value] = true
+					pairs = append(pairs, p)
+				}
+			}
+		}
+	}
+	return pairs, nil
+}
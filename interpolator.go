@@ -4,152 +4,292 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
-	"regexp"
+	"strings"
 )
 
+// MaxExpressionLength is the maximum number of bytes between "${" and "}" of a substitution point. The
+// [pia.Interpolator] never looks further ahead than this when searching for the end of a substitution point, text
+// beginning with "${" which is not terminated within this many bytes is passed through untouched.
+const MaxExpressionLength = 4096
+
 var (
-	ErrKeyNotFound                   = errors.New("key not found")
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrUnknownFilter is returned along with [pia.ErrKeyNotFound] for substitution points which cannot be resolved and
+	// whose last key is named like a filter, since it may have been meant as a filter which has not been registered.
+	ErrUnknownFilter = errors.New("unknown filter")
+	// Deprecated: ErrInsufficientDestinationLength is no longer returned, a [pia.Interpolator] can be read using
+	// destinations of any length.
 	ErrInsufficientDestinationLength = errors.New("destination size for substituting reader must be greater than 2")
 )
 
 // WrapReader returns a [pia.Interpolator] that uses the supplied [pia.KeyResolver] as source for substitutions
 // and the supplied [io.Reader] as its target.
-func WrapReader(resolver KeyResolver, r io.Reader) *Interpolator {
-	return &Interpolator{
-		prefix:   regexp.MustCompile(`\${`),
-		matcher:  regexp.MustCompile(`\${(.+?)}`),
+func WrapReader(resolver KeyResolver, r io.Reader, opts ...InterpolatorOpt) *Interpolator {
+	ip := &Interpolator{
 		resolver: resolver,
-		wrapped:  bufio.NewReader(r),
-		carry:    bytes.NewBuffer(make([]byte, 0)),
+		filters:  DefaultFilters(),
+		wrapped:  bufio.NewReaderSize(r, MaxExpressionLength+2),
+		line:     1,
+		column:   1,
+	}
+	for _, opt := range opts {
+		opt(ip)
+	}
+	return ip
+}
+
+// InterpolatorOpt configures a [pia.Interpolator] created by [pia.WrapReader].
+type InterpolatorOpt func(*Interpolator)
+
+// WithSource names the source of the wrapped reader, such as the path of a file. The name is included in any
+// [pia.InterpolationError] returned by the [pia.Interpolator].
+func WithSource(name string) InterpolatorOpt {
+	return func(ip *Interpolator) {
+		ip.source = name
+	}
+}
+
+// WithPosition sets the position of the first byte of the wrapped reader, which is used when the wrapped reader is an
+// excerpt of a larger source. Positions are 1-based and start at line 1 and column 1 by default.
+func WithPosition(line, column int) InterpolatorOpt {
+	return func(ip *Interpolator) {
+		ip.line = line
+		ip.column = column
+	}
+}
+
+// WithCollect makes the [pia.Interpolator] continue past substitution points whose keys cannot be resolved, leaving
+// them untouched in the output. Once the wrapped reader has been exhausted, a [pia.InterpolationErrors] listing every
+// such substitution point is returned in place of [io.EOF]. Errors other than unresolvable keys are still returned
+// immediately.
+func WithCollect() InterpolatorOpt {
+	return func(ip *Interpolator) {
+		ip.collect = true
+	}
+}
+
+// WithFilter registers a [pia.Filter] under the provided name, replacing any built-in filter of the same name.
+func WithFilter(name string, f Filter) InterpolatorOpt {
+	return func(ip *Interpolator) {
+		ip.filters[name] = f
+	}
+}
+
+// WithFilters registers every [pia.Filter] of the supplied registry, replacing any built-in filter of the same name.
+func WithFilters(filters Filters) InterpolatorOpt {
+	return func(ip *Interpolator) {
+		for name, f := range filters {
+			ip.filters[name] = f
+		}
 	}
 }
 
 // Interpolator decorates the wrapped reader by replacing any occurrences of substitution points defined using
 // "${key}" syntax with the corresponding value according to the supplied [pia.KeyResolver]. Since a [pia.KeyResolver]
 // is powering the substitution, all values must be supplied as strings and will be placed unquoted into the stream.
+//
+// A substitution point may list several keys separated by '|', in which case the first key that can be resolved is
+// used, and may end with ":-" followed by a default value which is used when none of the keys can be resolved. For
+// example, "${env:PORT:-8080}" or "${env:TOKEN|props:token}".
+//
+// The resolved value can be transformed by appending one or more filters separated by '|', such as
+// "${props:password | json}". See [pia.DefaultFilters] for the filters available by default.
+//
+// A substitution point is escaped by doubling its dollar sign, "$${key}" is written as the literal text "${key}".
+//
+// The wrapped reader is scanned in a single pass. A substitution point ends at the first '}' following "${" and may
+// neither be empty, span several lines nor be longer than [pia.MaxExpressionLength], text which does not form a
+// substitution point is passed through as is. An Interpolator holds the state of the scan and must therefore not be
+// copied once it has been read from.
+//
+// Substitution points which cannot be resolved cause a [pia.InterpolationError] to be returned, which carries the
+// position of the substitution point within the wrapped reader.
 type Interpolator struct {
-	prefix  *regexp.Regexp
-	matcher *regexp.Regexp
-
 	resolver KeyResolver
+	filters  Filters
 	wrapped  *bufio.Reader
-	carry    io.ReadWriter
+	source   string
+	collect  bool
+	// missing holds the substitution points which could not be resolved in collect mode.
+	missing InterpolationErrors
+	// line and column is the position of the next byte to be scanned from the wrapped reader.
+	line   int
+	column int
+	// expressions caches parsed expressions since the same substitution point is often repeated throughout a stream.
+	expressions map[string]expression
+	// pending holds output which has been scanned but not yet read.
+	pending bytes.Buffer
+	// err is the first error encountered while scanning, it is returned once pending has been drained.
+	err error
 }
 
 // Read implements the [io.Reader] interface for seamless interoperability with the Go standard library.
-func (ip Interpolator) Read(p []byte) (int, error) {
-	if len(p) < 2 {
-		// Destination must be able to contain at least "${" for Interpolator to be able to find substitution
-		// points. As such, the buffer must be at least two bytes long.
-		return 0, ErrInsufficientDestinationLength
+func (ip *Interpolator) Read(p []byte) (int, error) {
+	for ip.pending.Len() < len(p) && ip.err == nil {
+		ip.err = ip.scan()
+	}
+	if ip.pending.Len() > 0 {
+		return ip.pending.Read(p)
+	}
+	return 0, ip.err
+}
+
+// scan advances the scan of the wrapped reader by one step, writing any resulting output to pending. A step consists
+// of the text up to and including the next '$', or of a single substitution point.
+func (ip *Interpolator) scan() error {
+	text, err := ip.wrapped.ReadSlice('$')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		ip.text(text)
+		return nil
+	}
+	if errors.Is(err, io.EOF) && len(ip.missing) > 0 {
+		ip.text(text)
+		return ip.missing
 	}
-	str, err := ip.read(len(p))
 	if err != nil {
-		return 0, err
+		ip.text(text)
+		return err
 	}
-	for _, match := range ip.match(str) {
-		str, err = ip.substitute(str, match)
-		if err != nil {
-			return 0, err
-		}
+	ip.text(text[:len(text)-1])
+	next, _ := ip.wrapped.Peek(2)
+	if bytes.HasPrefix(next, []byte("${")) {
+		// An escaped substitution point, "$${", is written as the literal text "${".
+		ip.pending.WriteString("${")
+		ip.column++
+		ip.advance(next)
+		_, err := ip.wrapped.Discard(2)
+		return err
 	}
-	copy(p, str)
-	if len(str) > len(p) {
-		_, err := ip.carry.Write([]byte(str)[len(p):])
-		if err != nil {
-			return 0, err
-		}
-		return len(p), nil
+	if len(next) == 0 || next[0] != '{' {
+		// Either the stream ends with a dollar sign or the dollar sign is not followed by an opening brace, in both
+		// cases the dollar sign is part of the text. Errors are left to be returned by the next step.
+		ip.text(text[len(text)-1:])
+		return nil
 	}
-	return len(str), nil
+	return ip.substitute()
 }
 
-// read returns the next processable chunk of data using ln as the pivoting length. It is possible that read returns
-// both shorter and longer strings based on the data residing within the raw read data.
-func (ip Interpolator) read(ln int) (string, error) {
-	str, err := ip.raw(ln)
-	if err != nil {
-		return "", err
-	}
-	if str[len(str)-1] == '$' {
-		// There is a possibility that the next rune in from the reader could be an open curly brace, which together
-		// with the dollar sign becomes the prefix of data that should be substituted. Therefore, read the next byte and
-		// include it in the string being processed.
-		extra, err := ip.wrapped.ReadByte()
-		if err != nil && !errors.Is(err, io.EOF) {
-			return "", err
-		} else if err == nil {
-			str += string(extra)
-		}
+// substitute expects the wrapped reader to be positioned at the opening brace of a possible substitution point. The
+// substitution point is replaced with its resolved value if it is well-formed, otherwise "${" is written as text and
+// the scan continues from the character following the brace.
+func (ip *Interpolator) substitute() error {
+	// Peek is bounded by the size of the buffer, which is what limits the lookahead of the Interpolator. The buffer fits
+	// the opening brace, the longest possible expression and the closing brace.
+	ahead, err := ip.wrapped.Peek(MaxExpressionLength + 2)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return err
+	}
+	end := bytes.IndexAny(ahead[1:], "}\n")
+	if end < 1 || ahead[1+end] != '}' {
+		ip.text([]byte("${"))
+		_, err := ip.wrapped.Discard(1)
+		return err
 	}
-	if ip.partials(str) {
-		// We need to go further into the wrapped reader to make sure we can substitute the next one as well
-		extra, err := ip.wrapped.ReadString('}')
-		if errors.Is(err, io.EOF) {
-			err = nil
+	src := ahead[1 : 1+end]
+	line, column := ip.line, ip.column
+	val, err := ip.expression(src).resolve(ip.resolver)
+	if err != nil {
+		ierr := &InterpolationError{
+			Source:     ip.source,
+			Line:       line,
+			Column:     column,
+			Expression: string(src),
+			Err:        err,
 		}
-		if err != nil {
-			return "", err
+		if !ip.collect || !errors.Is(err, ErrKeyNotFound) {
+			return ierr
 		}
-		str += extra
+		ip.missing = append(ip.missing, ierr)
+		val = "${" + string(src) + "}"
 	}
-	return str, nil
+	ip.pending.WriteString(val)
+	// The position is advanced past the dollar sign preceding the brace as well.
+	ip.column++
+	ip.advance(ahead[:end+2])
+	_, err = ip.wrapped.Discard(end + 2)
+	return err
 }
 
-// raw returns ln or fewer bytes of data from the carry and wrapped readers without performing any modifications or
-// additions to the data.
-func (ip Interpolator) raw(ln int) (string, error) {
-	p := make([]byte, ln)
-	cn, err := ip.carry.Read(p)
-	if errors.Is(err, io.EOF) {
-		// The carry is expected to not contain data with each read and thus receiving an EOF error is considered
-		// normal.
-		cn = 0
-	} else if err != nil {
-		return "", err
+// text writes b to the output as is and advances the position of the scan past it.
+func (ip *Interpolator) text(b []byte) {
+	ip.pending.Write(b)
+	ip.advance(b)
+}
+
+// advance moves the position of the scan past b. Columns are counted in runes, which is why UTF-8 continuation bytes
+// are not counted. This keeps the column correct even if a rune is split between two calls.
+func (ip *Interpolator) advance(b []byte) {
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		ip.line += bytes.Count(b, []byte{'\n'})
+		ip.column = 1
+		b = b[i+1:]
 	}
-	if cn == len(p) {
-		return string(p), nil
+	for _, c := range b {
+		if c&0xC0 != 0x80 {
+			ip.column++
+		}
 	}
+}
 
-	wn, err := ip.wrapped.Read(p[cn:])
-	if errors.Is(err, io.EOF) && cn > 0 {
-		// If the wrapped reader has reached EOF, but there is data still being read from the carry then continue
-		// reading only from the carry.
-		return string(p[:cn]), nil
-	} else if err != nil {
-		return "", err
+func (ip *Interpolator) expression(src []byte) expression {
+	// The conversion of src to a string does not allocate when only used to index the map.
+	if expr, ok := ip.expressions[string(src)]; ok {
+		return expr
 	}
+	if ip.expressions == nil {
+		ip.expressions = make(map[string]expression)
+	}
+	expr := parseExpression(string(src), ip.filters)
+	ip.expressions[string(src)] = expr
+	return expr
+}
 
-	return string(p[:cn+wn]), nil
+// InterpolationError describes a substitution point which could not be resolved.
+type InterpolationError struct {
+	// Source is the name given to the interpolated reader using [pia.WithSource], it may be empty.
+	Source string
+	// Line and Column is the 1-based position of the "${" beginning the substitution point, columns are counted in
+	// runes.
+	Line   int
+	Column int
+	// Expression is the text found between "${" and "}".
+	Expression string
+	Err        error
 }
 
-func (ip Interpolator) substitute(str string, match []string) (string, error) {
-	val, err := ip.resolver.Resolve(match[1])
-	if err != nil {
-		return "", err
+func (e *InterpolationError) Error() string {
+	pos := fmt.Sprintf("%d:%d", e.Line, e.Column)
+	if e.Source != "" {
+		pos = e.Source + ":" + pos
 	}
-	// Compiles a new [regexp.Regexp] value with each substitution which is not optimal for performance. Remains to be
-	// measured and benchmarked.
-	return regexp.MustCompile(regexp.QuoteMeta(match[0])).ReplaceAllLiteralString(str, val), nil
+	return fmt.Sprintf("%s: ${%s}: %v", pos, e.Expression, e.Err)
 }
 
-func (ip Interpolator) match(str string) [][]string {
-	return ip.matcher.FindAllStringSubmatch(str, -1)
+func (e *InterpolationError) Unwrap() error {
+	return e.Err
 }
 
-// partials reports whether the supplied string is potentially containing partial substitution points with respect to
-// the rest of the stream. However, this cannot be guaranteed without potentially reading the entire wrapped stream and
-// checking whether there exists a terminating character "}".
-func (ip Interpolator) partials(str string) bool {
-	return ip.prefixes(str) > ip.points(str)
-}
+// InterpolationErrors lists every substitution point which could not be resolved by a [pia.Interpolator] in collect
+// mode, in the order they appear in the interpolated reader.
+type InterpolationErrors []*InterpolationError
 
-func (ip Interpolator) points(str string) int {
-	return len(ip.matcher.FindAllStringIndex(str, -1))
+func (e InterpolationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return fmt.Sprintf("%d unresolved substitution points:\n%s", len(e), strings.Join(lines, "\n"))
 }
 
-func (ip Interpolator) prefixes(str string) int {
-	return len(ip.prefix.FindAllStringIndex(str, -1))
+func (e InterpolationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
 }
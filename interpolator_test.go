@@ -2,11 +2,14 @@ package pia_test
 
 import (
 	"errors"
+	"fmt"
 	"github.com/crookdc/pia"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"slices"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestSubstitutingReader_Read(t *testing.T) {
@@ -75,6 +78,169 @@ func TestSubstitutingReader_Read(t *testing.T) {
 				expected:       "${env.username",
 				readBufferSize: 4,
 			},
+			{
+				name: "single byte destination",
+				resolver: map[string]string{
+					"env.username": "pia",
+				},
+				input:          "$ ${env.username}${env.username}$",
+				expected:       "$ piapia$",
+				readBufferSize: 1,
+			},
+			{
+				name:           "empty substitution point",
+				resolver:       map[string]string{},
+				input:          "${}",
+				expected:       "${}",
+				readBufferSize: 512,
+			},
+			{
+				name: "substitution point spanning lines",
+				resolver: map[string]string{
+					"env.username": "pia",
+				},
+				input:          "${env\n.username} ${env.username}",
+				expected:       "${env\n.username} pia",
+				readBufferSize: 4,
+			},
+			{
+				name: "escaped substitution point",
+				resolver: map[string]string{
+					"env.username": "pia",
+				},
+				input:          "echo \"$${HOME}\" ${env.username} `$${x}` $$HOME",
+				expected:       "echo \"${HOME}\" pia `${x}` $$HOME",
+				readBufferSize: 2,
+			},
+			{
+				name: "escaped dollar sign preceding substitution point",
+				resolver: map[string]string{
+					"env.username": "pia",
+				},
+				input:          "$$${env.username} $$",
+				expected:       "$${env.username} $$",
+				readBufferSize: 512,
+			},
+			{
+				name:           "substitution point exceeding maximum length",
+				resolver:       map[string]string{},
+				input:          "${" + strings.Repeat("k", pia.MaxExpressionLength+1) + "}",
+				expected:       "${" + strings.Repeat("k", pia.MaxExpressionLength+1) + "}",
+				readBufferSize: 512,
+			},
+			{
+				name: "substitution point of maximum length",
+				resolver: map[string]string{
+					strings.Repeat("k", pia.MaxExpressionLength): "pia",
+				},
+				input:          "${" + strings.Repeat("k", pia.MaxExpressionLength) + "}",
+				expected:       "pia",
+				readBufferSize: 512,
+			},
+			{
+				name:           "default value",
+				resolver:       map[string]string{},
+				input:          "port=${env:PORT:-8080}",
+				expected:       "port=8080",
+				readBufferSize: 512,
+			},
+			{
+				name:           "empty default value",
+				resolver:       map[string]string{},
+				input:          "[${env:PORT:-}]",
+				expected:       "[]",
+				readBufferSize: 512,
+			},
+			{
+				name: "fallback chain",
+				resolver: map[string]string{
+					"props:token": "abc",
+				},
+				input:          "${env:TOKEN|props:token}",
+				expected:       "abc",
+				readBufferSize: 512,
+			},
+			{
+				name: "fallback chain preferring first key",
+				resolver: map[string]string{
+					"env:TOKEN":   "def",
+					"props:token": "abc",
+				},
+				input:          "${env:TOKEN | props:token:-none}",
+				expected:       "def",
+				readBufferSize: 512,
+			},
+			{
+				name:           "fallback chain with default value",
+				resolver:       map[string]string{},
+				input:          "${env:TOKEN|props:token:-none}",
+				expected:       "none",
+				readBufferSize: 512,
+			},
+			{
+				name: "filter",
+				resolver: map[string]string{
+					"props:password": `p"w\d`,
+				},
+				input:          `{"password": "${props:password | json}"}`,
+				expected:       `{"password": "p\"w\\d"}`,
+				readBufferSize: 512,
+			},
+			{
+				name: "filter chain",
+				resolver: map[string]string{
+					"env:USER": " pia ",
+				},
+				input:          "${env:USER | trim | upper}",
+				expected:       "PIA",
+				readBufferSize: 512,
+			},
+			{
+				name:           "filter applied to default value",
+				resolver:       map[string]string{},
+				input:          "q=${env:QUERY:-a b | urlencode}",
+				expected:       "q=a+b",
+				readBufferSize: 512,
+			},
+			{
+				name: "filter after fallback chain",
+				resolver: map[string]string{
+					"props:creds": "user:pass",
+				},
+				input:          "Basic ${env:CREDS|props:creds|base64}",
+				expected:       "Basic dXNlcjpwYXNz",
+				readBufferSize: 512,
+			},
+			{
+				name:           "unprefixed fallback key",
+				resolver:       map[string]string{"other": "abc"},
+				input:          "${token|other}",
+				expected:       "abc",
+				readBufferSize: 512,
+			},
+			{
+				name:           "default value containing a separator",
+				resolver:       map[string]string{},
+				input:          "${env:MODE:-read|write}",
+				expected:       "read|write",
+				readBufferSize: 512,
+			},
+			{
+				name:           "default value containing a separator followed by a filter",
+				resolver:       map[string]string{},
+				input:          "${env:MODE:-read|write | upper}",
+				expected:       "READ|WRITE",
+				readBufferSize: 512,
+			},
+			{
+				name: "key named as filter",
+				resolver: map[string]string{
+					"upper": "pia",
+				},
+				input:          "${upper | upper}",
+				expected:       "PIA",
+				readBufferSize: 512,
+			},
 		}
 		for _, test := range tests {
 			t.Run(test.name, func(t *testing.T) {
@@ -99,6 +265,21 @@ func TestSubstitutingReader_Read(t *testing.T) {
 		}
 	})
 
+	t.Run("custom filter", func(t *testing.T) {
+		r := pia.WrapReader(
+			pia.MapResolver(map[string]string{"name": "pia"}),
+			strings.NewReader("${name | reverse}"),
+			pia.WithFilter("reverse", func(s string) (string, error) {
+				runes := []rune(s)
+				slices.Reverse(runes)
+				return string(runes), nil
+			}),
+		)
+		actual, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, "aip", string(actual))
+	})
+
 	t.Run("sad path", func(t *testing.T) {
 		tests := []struct {
 			name           string
@@ -115,10 +296,25 @@ func TestSubstitutingReader_Read(t *testing.T) {
 				readBufferSize: 512,
 			},
 			{
-				name:           "insufficient destination length",
-				input:          "${env.username}",
-				err:            pia.ErrInsufficientDestinationLength,
-				readBufferSize: 1,
+				name:           "exhausted fallback chain",
+				input:          "${env:TOKEN|props:token}",
+				resolver:       map[string]string{},
+				err:            pia.ErrKeyNotFound,
+				readBufferSize: 512,
+			},
+			{
+				name:           "misspelled filter",
+				input:          `{"password": "${props:password | jsno}"}`,
+				resolver:       map[string]string{},
+				err:            pia.ErrUnknownFilter,
+				readBufferSize: 512,
+			},
+			{
+				name:           "misspelled filter is also a missing key",
+				input:          `{"password": "${props:password | jsno}"}`,
+				resolver:       map[string]string{},
+				err:            pia.ErrKeyNotFound,
+				readBufferSize: 512,
 			},
 		}
 		for _, test := range tests {
@@ -127,18 +323,101 @@ func TestSubstitutingReader_Read(t *testing.T) {
 					pia.MapResolver(test.resolver),
 					strings.NewReader(test.input),
 				)
-				for {
+				var err error
+				for err == nil {
 					buf := make([]byte, test.readBufferSize)
-					_, err := r.Read(buf)
-					if errors.Is(err, io.EOF) {
-						break
-					}
-					if err != nil {
-						assert.True(t, errors.Is(err, test.err))
-						break
-					}
+					_, err = r.Read(buf)
 				}
+				assert.ErrorIs(t, err, test.err)
 			})
 		}
 	})
 }
+
+func TestInterpolator_errors(t *testing.T) {
+	t.Run("position", func(t *testing.T) {
+		r := pia.WrapReader(
+			pia.MapResolver{"host": "example.com"},
+			strings.NewReader("url:\n  target: https://${host}/ö/${missing}"),
+			pia.WithSource("users.yml"),
+		)
+		_, err := io.ReadAll(r)
+		var ierr *pia.InterpolationError
+		assert.True(t, errors.As(err, &ierr))
+		assert.ErrorIs(t, err, pia.ErrKeyNotFound)
+		assert.Equal(t, "users.yml", ierr.Source)
+		assert.Equal(t, 2, ierr.Line)
+		assert.Equal(t, 29, ierr.Column)
+		assert.Equal(t, "missing", ierr.Expression)
+		assert.True(t, strings.HasPrefix(err.Error(), "users.yml:2:29: ${missing}: "))
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		r := pia.WrapReader(
+			pia.MapResolver{"host": "example.com"},
+			strings.NewReader("${first}\n${host} ${second:-fallback} ${env:A|env:B}\n"),
+			pia.WithCollect(),
+		)
+		// Reading a single byte at a time makes sure that the position is kept across reads.
+		actual, err := io.ReadAll(iotest.OneByteReader(r))
+		assert.Equal(t, "${first}\nexample.com fallback ${env:A|env:B}\n", string(actual))
+		var missing pia.InterpolationErrors
+		assert.True(t, errors.As(err, &missing))
+		assert.ErrorIs(t, err, pia.ErrKeyNotFound)
+		assert.Len(t, missing, 2)
+		assert.Equal(t, "first", missing[0].Expression)
+		assert.Equal(t, 1, missing[0].Line)
+		assert.Equal(t, 1, missing[0].Column)
+		assert.Equal(t, "env:A|env:B", missing[1].Expression)
+		assert.Equal(t, 2, missing[1].Line)
+		assert.Equal(t, 29, missing[1].Column)
+	})
+
+	t.Run("collect returns other errors immediately", func(t *testing.T) {
+		r := pia.WrapReader(
+			pia.MapResolver{"name": "pia"},
+			strings.NewReader("${missing} ${name | broken}"),
+			pia.WithCollect(),
+			pia.WithFilter("broken", func(string) (string, error) {
+				return "", io.ErrUnexpectedEOF
+			}),
+		)
+		_, err := io.ReadAll(r)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.NotErrorIs(t, err, pia.ErrKeyNotFound)
+	})
+}
+
+func BenchmarkInterpolator_Read(b *testing.B) {
+	resolver := pia.MapResolver{
+		"props:username": "pia",
+		"props:password": "P@$$W0RD",
+	}
+	benchmarks := []struct {
+		name string
+		line string
+	}{
+		{
+			name: "plain text",
+			line: `{"id": 1, "name": "lorem ipsum dolor sit amet", "price": "$12.50"},` + "\n",
+		},
+		{
+			name: "substitutions",
+			line: `{"username": "${props:username}", "password": "${props:password | json}"},` + "\n",
+		},
+	}
+	for _, bm := range benchmarks {
+		for _, size := range []int{1 << 20, 8 << 20} {
+			body := strings.Repeat(bm.line, size/len(bm.line))
+			b.Run(fmt.Sprintf("%s/%dMB", bm.name, size>>20), func(b *testing.B) {
+				b.SetBytes(int64(len(body)))
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := io.Copy(io.Discard, pia.WrapReader(resolver, strings.NewReader(body))); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package pia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/crookdc/pia/internal/yamlnode"
+	"gopkg.in/yaml.v3"
+)
+
+// marshalNode encodes the YAML node as JSON. The keys of mappings are kept in the order in which they are written, and
+// scalars are encoded according to their YAML type, which means that "42" is a string while 42 is a number. Timestamps
+// are encoded as strings holding the text they were written as, and the keys of mappings merged into a mapping using
+// "<<" are encoded as part of it.
+func marshalNode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeNode(&buf, node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeNode(buf, node.Content[0])
+	case yaml.AliasNode:
+		return writeNode(buf, yamlnode.Resolve(node))
+	case yaml.MappingNode:
+		pairs, err := yamlnode.MappingPairs(node)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte('{')
+		for i, pair := range pairs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeValue(buf, pair.Key.Value); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeNode(buf, pair.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!timestamp" {
+			// Decoding a timestamp yields a time.Time, which would be encoded in a layout other than the one it was
+			// written in.
+			return writeValue(buf, node.Value)
+		}
+		var v any
+		if err := node.Decode(&v); err != nil {
+			return err
+		}
+		if err := writeValue(buf, v); err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+	default:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// writeValue writes v encoded as JSON to buf. Unlike [json.Marshal], characters such as '<' and '&' are not escaped.
+func writeValue(buf *bytes.Buffer, v any) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return nil
+}
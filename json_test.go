@@ -0,0 +1,64 @@
+package pia_test
+
+import (
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransaction_Execute_json(t *testing.T) {
+	var contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "create.yml")
+	assert.Nil(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+method: POST
+url:
+  target: %s
+body:
+  json:
+    name: ${name}
+    quote: 'He said "hi": ${name}'
+    zip: "01234"
+    age: ${age}
+    admin: false
+    nickname: ~
+    ratio: 0.5
+    tags:
+      - a
+      - b
+    born: 2024-01-01
+    html: <b>${name} & co</b>
+    home: &home
+      country: SE
+      city: Uppsala
+    address:
+      <<: *home
+      city: Stockholm
+`, server.URL)), 0644))
+	resolver := pia.MapResolver{"name": "Pia", "age": "7"}
+	for _, opts := range [][]pia.TransactionOpt{nil, {pia.WithStructuredInterpolation()}} {
+		tx, err := pia.ReadTransaction(resolver, path, opts...)
+		assert.Nil(t, err)
+		_, err = tx.Execute(pia.ExecuteOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "application/json", contentType)
+		assert.Equal(
+			t,
+			`{"name":"Pia","quote":"He said \"hi\": Pia","zip":"01234","age":7,"admin":false,"nickname":null,`+
+				`"ratio":0.5,"tags":["a","b"],"born":"2024-01-01","html":"<b>Pia & co</b>",`+
+				`"home":{"country":"SE","city":"Uppsala"},"address":{"country":"SE","city":"Stockholm"}}`,
+			body,
+		)
+	}
+}
@@ -0,0 +1,173 @@
+package pia
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// part is a single part of a multipart/form-data body in its textual YAML state. A part holds either a text value or
+// the contents of a file.
+type part struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+	File  string `yaml:"file"`
+	// Filename is sent as the name of the file, it defaults to the base name of File.
+	Filename string `yaml:"filename"`
+	// ContentType defaults to the type associated with the extension of File, or to application/octet-stream if there
+	// is none. Text values are sent without a content type unless one is given.
+	ContentType string            `yaml:"content_type"`
+	Headers     map[string]string `yaml:"headers"`
+}
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// header returns the MIME header of the part.
+func (p *part) header() textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	for k, v := range p.Headers {
+		h.Set(k, v)
+	}
+	filename := p.Filename
+	if filename == "" && p.File != "" {
+		filename = filepath.Base(p.File)
+	}
+	disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(p.Name))
+	if filename != "" {
+		disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(filename))
+	}
+	h.Set("Content-Disposition", disposition)
+	contentType := p.ContentType
+	if contentType == "" && p.File != "" {
+		contentType = mime.TypeByExtension(filepath.Ext(p.File))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	return h
+}
+
+// multipartReader returns a reader of the multipart/form-data body made up of the parts along with its content type.
+// The contents of files are streamed from disk as the body is read rather than being buffered, each file is opened
+// once the reader reaches it.
+func multipartReader(wd string, parts []part) (*multipartBody, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	body := &multipartBody{}
+	var readers []io.Reader
+	for _, p := range parts {
+		if p.Name == "" {
+			return nil, "", errors.New("every multipart part requires a name")
+		}
+		if p.File != "" && p.Value != "" {
+			return nil, "", fmt.Errorf("multipart part %s cannot have both a value and a file", p.Name)
+		}
+		pw, err := w.CreatePart(p.header())
+		if err != nil {
+			return nil, "", err
+		}
+		if p.File == "" {
+			_, _ = io.WriteString(pw, p.Value)
+			continue
+		}
+		path := join(wd, p.File)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, "", err
+		}
+		// The boundary and header written so far precede the contents of the file.
+		f := &lazyFile{path: path}
+		readers = append(readers, bytes.NewReader(bytes.Clone(buf.Bytes())), f)
+		body.files = append(body.files, f)
+		body.size += int64(buf.Len()) + info.Size()
+		buf.Reset()
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	readers = append(readers, bytes.NewReader(buf.Bytes()))
+	body.size += int64(buf.Len())
+	body.r = io.MultiReader(readers...)
+	return body, w.FormDataContentType(), nil
+}
+
+// multipartBody is a reader of a multipart/form-data body. Closing the body closes any file which is still open, which
+// happens when the body is not read to its end, for example because the server responds before the body has been sent.
+// Any read after closing the body returns [io.EOF].
+type multipartBody struct {
+	r     io.Reader
+	files []*lazyFile
+	// size is the length of the body given the sizes of the files when the body was created.
+	size   int64
+	closed bool
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, io.EOF
+	}
+	return b.r.Read(p)
+}
+
+func (b *multipartBody) Close() error {
+	b.closed = true
+	var errs []error
+	for _, f := range b.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// lazyFile is a reader of a file which is not opened until it is first read and which is closed once it has been read
+// to its end. The contents of the file are read through wrap if it is non-nil.
+type lazyFile struct {
+	path string
+	wrap func(io.Reader) io.Reader
+	f    *os.File
+	r    io.Reader
+	done bool
+}
+
+func (l *lazyFile) Read(p []byte) (int, error) {
+	if l.done {
+		return 0, io.EOF
+	}
+	if l.f == nil {
+		f, err := os.Open(l.path)
+		if err != nil {
+			return 0, err
+		}
+		l.f, l.r = f, f
+		if l.wrap != nil {
+			l.r = l.wrap(f)
+		}
+	}
+	n, err := l.r.Read(p)
+	if err != nil {
+		l.done = true
+		l.f.Close()
+	}
+	return n, err
+}
+
+// Close closes the file if it has been opened but not yet read to its end, any further read returns [io.EOF].
+func (l *lazyFile) Close() error {
+	if l.done {
+		return nil
+	}
+	l.done = true
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,137 @@
+package pia_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransaction_Execute_multipart(t *testing.T) {
+	type received struct {
+		name        string
+		filename    string
+		contentType string
+		custom      string
+		body        []byte
+	}
+	var parts []received
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := io.ReadAll(p)
+			parts = append(parts, received{
+				name:        p.FormName(),
+				filename:    p.FileName(),
+				contentType: p.Header.Get("Content-Type"),
+				custom:      p.Header.Get("X-Checksum"),
+				body:        body,
+			})
+		}
+	}))
+	defer server.Close()
+
+	wd := t.TempDir()
+	large := bytes.Repeat([]byte("0123456789abcdef"), 1<<19)
+	assert.Nil(t, os.WriteFile(filepath.Join(wd, "large.bin"), large, 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(wd, "cat.png"), []byte("not really a png"), 0644))
+	path := filepath.Join(wd, "upload.yml")
+	assert.Nil(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+method: POST
+url:
+  target: %s
+body:
+  multipart:
+    - name: description
+      value: ${description}
+    - name: picture
+      file: cat.png
+      headers:
+        X-Checksum: abc
+    - name: archive
+      file: large.bin
+      filename: "backup \"today\".bin"
+      content_type: application/x-archive
+    - name: inline
+      value: '{"inline": true}'
+      filename: inline.json
+      content_type: application/json
+`, server.URL)), 0644))
+
+	tx, err := pia.ReadTransaction(pia.MapResolver{"description": "A cat"}, path)
+	assert.Nil(t, err)
+	res, err := tx.Execute(pia.ExecuteOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	media, params, err := mime.ParseMediaType(contentType)
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/form-data", media)
+	assert.NotEmpty(t, params["boundary"])
+	assert.Equal(t, []received{
+		{name: "description", body: []byte("A cat")},
+		{name: "picture", filename: "cat.png", contentType: "image/png", custom: "abc", body: []byte("not really a png")},
+		{name: "archive", filename: `backup "today".bin`, contentType: "application/x-archive", body: large},
+		{name: "inline", filename: "inline.json", contentType: "application/json", body: []byte(`{"inline": true}`)},
+	}, parts)
+}
+
+func TestTransaction_Request_multipart(t *testing.T) {
+	wd := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(wd, "a.bin"), bytes.Repeat([]byte("a"), 1<<16), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(wd, "b.bin"), []byte("b"), 0644))
+	src := "body:\n  multipart:\n    - name: a\n      file: a.bin\n    - name: note\n      value: hi\n    - name: b\n      file: b.bin"
+
+	tx, err := pia.ParseTransaction(wd, strings.NewReader(src))
+	assert.Nil(t, err)
+	req, err := tx.Request()
+	assert.Nil(t, err)
+	body, err := io.ReadAll(req.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(body)), req.ContentLength)
+
+	// A body which is closed before being read to its end must close the file being read.
+	tx, err = pia.ParseTransaction(wd, strings.NewReader(src))
+	assert.Nil(t, err)
+	req, err = tx.Request()
+	assert.Nil(t, err)
+	_, err = io.ReadFull(req.Body, make([]byte, 1024))
+	assert.Nil(t, err)
+	assert.Nil(t, req.Body.Close())
+	n, err := req.Body.Read(make([]byte, 1024))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestParseTransaction_multipart(t *testing.T) {
+	for _, src := range []string{
+		"body:\n  multipart:\n    - value: no name",
+		"body:\n  multipart:\n    - name: missing\n      file: missing.bin",
+		"body:\n  multipart:\n    - name: both\n      file: missing.bin\n      value: value",
+	} {
+		_, err := pia.ParseTransaction(t.TempDir(), strings.NewReader(src))
+		assert.NotNil(t, err, src)
+	}
+}
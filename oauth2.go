@@ -0,0 +1,186 @@
+package pia
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crookdc/pia/squeak"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// oauth2Token is the successful response of an OAuth 2.0 token endpoint as defined by RFC 6749.
+type oauth2Token struct {
+	AccessToken  string      `json:"access_token"`
+	ExpiresIn    json.Number `json:"expires_in"`
+	RefreshToken string      `json:"refresh_token"`
+}
+
+// oauth2Error is the error response of an OAuth 2.0 token endpoint as defined by RFC 6749.
+type oauth2Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (a *Auth) validateOAuth2() error {
+	if a.TokenURL == "" {
+		return errors.New("oauth2 auth requires a token_url")
+	}
+	switch a.Grant {
+	case "client_credentials":
+	case "password":
+		if a.Username == "" {
+			return errors.New("oauth2 password grant requires a username")
+		}
+	case "refresh_token":
+		if a.RefreshToken == "" {
+			return errors.New("oauth2 refresh_token grant requires a refresh_token")
+		}
+	default:
+		return fmt.Errorf("unsupported oauth2 grant %q: expected client_credentials, password or refresh_token", a.Grant)
+	}
+	if a.ClientAuth != "" && a.ClientAuth != "basic" && a.ClientAuth != "body" {
+		return fmt.Errorf("unsupported oauth2 client_auth %s: expected basic or body", a.ClientAuth)
+	}
+	return nil
+}
+
+// token returns the access token cached in the session unless it is about to expire, in which case a new token is
+// obtained from the token endpoint and cached in its place. The cached tokens are only used if they were issued for the
+// same token url, client and scope, which keeps the token of one authorization server from being sent to another that
+// shares the session key.
+func (a *Auth) token(ctx context.Context, client *http.Client, session *Session) (string, error) {
+	if session == nil {
+		session = NewSession()
+	}
+	key := a.SessionKey
+	if key == "" {
+		key = "oauth2"
+	}
+	issuer, err := session.Resolve(key + "_issuer")
+	issued := err == nil && issuer == a.issuer()
+	if token, err := session.Resolve(key + "_access_token"); err == nil && issued && a.fresh(session, key) {
+		return token, nil
+	}
+	var token *oauth2Token
+	refresh, err := session.Resolve(key + "_refresh_token")
+	if err != nil || !issued {
+		refresh = a.RefreshToken
+	}
+	if refresh != "" {
+		token, err = a.requestToken(ctx, client, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refresh},
+		})
+		if err != nil && a.Grant == "refresh_token" {
+			return "", err
+		}
+		if err != nil {
+			// Refresh tokens expire and may be revoked, in which case a token is obtained using the grant as if there
+			// was no refresh token.
+			session.put(key+"_refresh_token", nil, false)
+		}
+	}
+	if token == nil {
+		form := url.Values{"grant_type": {a.Grant}}
+		if a.Grant == "password" {
+			form.Set("username", a.Username)
+			form.Set("password", a.Password)
+		}
+		token, err = a.requestToken(ctx, client, form)
+		if err != nil {
+			return "", err
+		}
+	}
+	session.put(key+"_issuer", squeak.NewString(a.issuer()), false)
+	session.put(key+"_access_token", squeak.NewString(token.AccessToken), true)
+	var expiry squeak.Object
+	if seconds, err := strconv.ParseInt(token.ExpiresIn.String(), 10, 64); err == nil && seconds > 0 {
+		expiry = squeak.NewString(a.clock().Add(time.Duration(seconds) * time.Second).Format(time.RFC3339))
+	}
+	session.put(key+"_expires_at", expiry, false)
+	if token.RefreshToken != "" {
+		session.put(key+"_refresh_token", squeak.NewString(token.RefreshToken), true)
+	} else if !issued {
+		// The refresh token of another client must not outlive the tokens it was issued along with.
+		session.put(key+"_refresh_token", nil, false)
+	}
+	return token.AccessToken, nil
+}
+
+// issuer identifies the token url, client and scope which the tokens cached in the session were issued for.
+func (a *Auth) issuer() string {
+	return url.Values{"token_url": {a.TokenURL}, "client_id": {a.ClientID}, "scope": {a.Scope}}.Encode()
+}
+
+// fresh reports whether the token cached in the session under key is valid for long enough to be used. Tokens without
+// a known expiry are always considered fresh.
+func (a *Auth) fresh(session *Session, key string) bool {
+	v, err := session.Resolve(key + "_expires_at")
+	if err != nil {
+		return true
+	}
+	expiry, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return false
+	}
+	before := a.RefreshBefore
+	if before == 0 {
+		before = 30 * time.Second
+	}
+	return a.clock().Add(before).Before(expiry)
+}
+
+func (a *Auth) requestToken(ctx context.Context, client *http.Client, form url.Values) (*oauth2Token, error) {
+	if a.Scope != "" {
+		form.Set("scope", a.Scope)
+	}
+	if a.ClientAuth == "body" {
+		form.Set("client_id", a.ClientID)
+		if a.ClientSecret != "" {
+			form.Set("client_secret", a.ClientSecret)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if a.ClientAuth != "body" && a.ClientID != "" {
+		// The client credentials are form encoded before being used for basic authentication according to RFC 6749.
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		var e oauth2Error
+		if err := json.Unmarshal(body, &e); err != nil || e.Code == "" {
+			return nil, fmt.Errorf("oauth2: %s grant failed with status %d", form.Get("grant_type"), res.StatusCode)
+		}
+		if e.Description != "" {
+			return nil, fmt.Errorf("oauth2: %s grant failed: %s: %s", form.Get("grant_type"), e.Code, e.Description)
+		}
+		return nil, fmt.Errorf("oauth2: %s grant failed: %s", form.Get("grant_type"), e.Code)
+	}
+	var token oauth2Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("oauth2: invalid token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("oauth2: token response has no access_token")
+	}
+	return &token, nil
+}
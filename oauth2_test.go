@@ -0,0 +1,236 @@
+package pia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/crookdc/pia/squeak"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenServer is a stand-in for an OAuth 2.0 authorization server which counts the grants it has been asked for.
+type tokenServer struct {
+	grants map[string]int
+	issued int
+}
+
+func (ts *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if id != "pia" || secret != "s3cr3t" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, `{"error":"invalid_client","error_description":"unknown client"}`)
+		return
+	}
+	grant := r.PostForm.Get("grant_type")
+	ts.grants[grant]++
+	switch {
+	case grant == "refresh_token" && r.PostForm.Get("refresh_token") == "revoked",
+		grant == "password" && r.PostForm.Get("password") != "hunter2":
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"error":"invalid_grant"}`)
+		return
+	}
+	ts.issued++
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  fmt.Sprintf("access-%d", ts.issued),
+		"token_type":    "Bearer",
+		"expires_in":    60,
+		"refresh_token": fmt.Sprintf("refresh-%d", ts.issued),
+	})
+}
+
+func TestAuth_oauth2(t *testing.T) {
+	ts := &tokenServer{grants: make(map[string]int)}
+	mux := http.NewServeMux()
+	mux.Handle("POST /token", ts)
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("Authorization"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tx, err := ParseTransaction("", strings.NewReader(fmt.Sprintf(`
+method: GET
+url:
+  target: %[1]s/api
+auth:
+  type: oauth2
+  grant: client_credentials
+  token_url: %[1]s/token
+  client_id: pia
+  client_secret: s3cr3t
+hooks:
+  after:
+    inline: |
+      print(session.oauth2_access_token);
+`, server.URL)))
+	assert.Nil(t, err)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tx.Auth.now = func() time.Time {
+		return now
+	}
+	session := NewSession()
+	var out bytes.Buffer
+	in := squeak.NewInterpreter("", &out)
+	in.Declare("session", session)
+	execute := func() string {
+		t.Helper()
+		out.Reset()
+		res, err := tx.Execute(ExecuteOptions{Session: session, Interpreter: in})
+		if !assert.Nil(t, err) {
+			return ""
+		}
+		body, err := io.ReadAll(res.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "Bearer access-1", execute())
+	assert.Equal(t, "access-1", out.String())
+	assert.True(t, session.Secret("oauth2_access_token"))
+	assert.True(t, session.Secret("oauth2_refresh_token"))
+	expiry, err := session.Resolve("oauth2_expires_at")
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-01-01T12:01:00Z", expiry)
+
+	// The cached token is used until it is about to expire.
+	now = now.Add(29 * time.Second)
+	assert.Equal(t, "Bearer access-1", execute())
+	assert.Equal(t, map[string]int{"client_credentials": 1}, ts.grants)
+
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, "Bearer access-2", execute())
+	assert.Equal(t, map[string]int{"client_credentials": 1, "refresh_token": 1}, ts.grants)
+	refresh, err := session.Resolve("oauth2_refresh_token")
+	assert.Nil(t, err)
+	assert.Equal(t, "refresh-2", refresh)
+
+	// A rejected refresh token falls back to the grant.
+	session.put("oauth2_refresh_token", squeak.NewString("revoked"), true)
+	session.put("oauth2_expires_at", nil, false)
+	session.put("oauth2_access_token", nil, false)
+	assert.Equal(t, "Bearer access-3", execute())
+	assert.Equal(t, map[string]int{"client_credentials": 2, "refresh_token": 2}, ts.grants)
+}
+
+func TestAuth_oauth2_issuer(t *testing.T) {
+	ts := &tokenServer{grants: make(map[string]int)}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+	users := Auth{
+		Type:         "oauth2",
+		Grant:        "client_credentials",
+		TokenURL:     server.URL,
+		ClientID:     "pia",
+		ClientSecret: "s3cr3t",
+	}
+	orders := users
+	orders.Scope = "orders:read"
+	session := NewSession()
+
+	token, err := users.token(t.Context(), http.DefaultClient, session)
+	assert.Nil(t, err)
+	assert.Equal(t, "access-1", token)
+	// Both configurations cache their tokens under the default session key, but the token issued for one of them must
+	// not be used by the other.
+	token, err = orders.token(t.Context(), http.DefaultClient, session)
+	assert.Nil(t, err)
+	assert.Equal(t, "access-2", token)
+	assert.Equal(t, map[string]int{"client_credentials": 2}, ts.grants)
+	token, err = orders.token(t.Context(), http.DefaultClient, session)
+	assert.Nil(t, err)
+	assert.Equal(t, "access-2", token)
+	assert.Equal(t, map[string]int{"client_credentials": 2}, ts.grants)
+}
+
+func TestAuth_oauth2_grants(t *testing.T) {
+	ts := &tokenServer{grants: make(map[string]int)}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+	tests := []struct {
+		name  string
+		auth  Auth
+		token string
+		err   string
+	}{
+		{
+			name: "password with client credentials in body",
+			auth: Auth{
+				Grant:        "password",
+				Username:     "user",
+				Password:     "hunter2",
+				ClientID:     "pia",
+				ClientSecret: "s3cr3t",
+				ClientAuth:   "body",
+			},
+			token: "access-1",
+		},
+		{
+			name: "refresh token",
+			auth: Auth{
+				Grant:        "refresh_token",
+				RefreshToken: "refresh-0",
+				ClientID:     "pia",
+				ClientSecret: "s3cr3t",
+			},
+			token: "access-2",
+		},
+		{
+			name: "revoked refresh token",
+			auth: Auth{
+				Grant:        "refresh_token",
+				RefreshToken: "revoked",
+				ClientID:     "pia",
+				ClientSecret: "s3cr3t",
+			},
+			err: "oauth2: refresh_token grant failed: invalid_grant",
+		},
+		{
+			name: "wrong password",
+			auth: Auth{
+				Grant:        "password",
+				Username:     "user",
+				Password:     "guess",
+				ClientID:     "pia",
+				ClientSecret: "s3cr3t",
+			},
+			err: "oauth2: password grant failed: invalid_grant",
+		},
+		{
+			name: "unknown client",
+			auth: Auth{
+				Grant:    "client_credentials",
+				ClientID: "someone",
+			},
+			err: "oauth2: client_credentials grant failed: invalid_client: unknown client",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.auth.Type = "oauth2"
+			test.auth.TokenURL = server.URL
+			assert.Nil(t, test.auth.validate())
+			token, err := test.auth.token(t.Context(), http.DefaultClient, nil)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.token, token)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package properties
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ParseDotenv reads properties using the format of dotenv files. Each line holds a KEY=VALUE pair which may be prefixed
+// with "export". Values are either unquoted, in which case they end at the first " #" and are trimmed of whitespace,
+// single-quoted, in which case they are taken literally, or double-quoted, in which case the escape sequences \n, \r,
+// \t, \" and \\ are supported. Quoted values may span multiple lines.
+func ParseDotenv(r io.Reader) (map[string]string, error) {
+	props := make(map[string]string)
+	scn := bufio.NewScanner(r)
+	n := 0
+	for scn.Scan() {
+		n++
+		start := n
+		line := strings.TrimSpace(scn.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "export "); ok {
+			line = strings.TrimSpace(rest)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, SyntaxError{Line: start, Msg: "expected KEY=VALUE"}
+		}
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, SyntaxError{Line: start, Msg: "invalid key: " + key}
+		}
+		value = strings.TrimSpace(value)
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			props[key] = value
+			continue
+		}
+		quote := value[0]
+		value = value[1:]
+		for {
+			end := closing(value, quote)
+			if end >= 0 {
+				trailing := strings.TrimSpace(value[end+1:])
+				if trailing != "" && trailing[0] != '#' {
+					return nil, SyntaxError{Line: n, Msg: "unexpected characters after closing quote"}
+				}
+				value = value[:end]
+				break
+			}
+			if !scn.Scan() {
+				return nil, SyntaxError{Line: start, Msg: "unterminated quoted value"}
+			}
+			n++
+			value += "\n" + scn.Text()
+		}
+		if quote == '"' {
+			value = unescapeDotenv(value)
+		}
+		props[key] = value
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// closing returns the index of the quote which terminates the quoted value, or -1 if it is not terminated. Double
+// quotes may be escaped using a backslash while single quotes cannot be escaped at all.
+func closing(value string, quote byte) int {
+	for i := 0; i < len(value); i++ {
+		if quote == '"' && value[i] == '\\' {
+			i++
+			continue
+		}
+		if value[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDotenv(s string) string {
+	return strings.NewReplacer(
+		`\n`, "\n",
+		`\r`, "\r",
+		`\t`, "\t",
+		`\"`, `"`,
+		`\\`, `\`,
+	).Replace(s)
+}
@@ -0,0 +1,198 @@
+// Package properties reads property files into flat maps of string keys and values. Java .properties files, dotenv
+// files as well as YAML and JSON documents are supported. Nested YAML and JSON documents are flattened so that the
+// value found at target.host in the document is stored under the key "target.host".
+package properties
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported property file format")
+
+// SyntaxError is returned when a property file is malformed. Line is the 1-indexed line on which the error was found.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (s SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error on line %d: %s", s.Line, s.Msg)
+}
+
+// Parser reads the properties of a single property file format.
+type Parser func(io.Reader) (map[string]string, error)
+
+// Parsers contains the [properties.Parser] used for each supported file extension.
+var Parsers = map[string]Parser{
+	".properties": ParseProperties,
+	".env":        ParseDotenv,
+	".yml":        ParseYAML,
+	".yaml":       ParseYAML,
+	".json":       ParseYAML,
+}
+
+// Supported reports whether the format of the named file is supported, based on its extension.
+func Supported(name string) bool {
+	_, ok := Parsers[extension(name)]
+	return ok
+}
+
+// ReadFile reads the property file found at path using the [properties.Parser] matching its extension. A file named
+// ".env" is read as a dotenv file.
+func ReadFile(path string) (map[string]string, error) {
+	parse, ok := Parsers[extension(path)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	props, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return props, nil
+}
+
+func extension(name string) string {
+	if filepath.Base(name) == ".env" {
+		return ".env"
+	}
+	return strings.ToLower(filepath.Ext(name))
+}
+
+// ParseProperties reads properties using the format of Java .properties files. Comments start with '#' or '!', keys
+// are separated from values by '=', ':' or whitespace, a trailing backslash continues the logical line on the next
+// line and the escape sequences \t, \n, \r, \f and \uXXXX are supported. Any other escaped character is taken
+// literally, which allows keys to contain separators.
+func ParseProperties(r io.Reader) (map[string]string, error) {
+	props := make(map[string]string)
+	scn := bufio.NewScanner(r)
+	n := 0
+	for scn.Scan() {
+		n++
+		start := n
+		line := strings.TrimLeft(scn.Text(), " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		for continued(line) {
+			line = line[:len(line)-1]
+			if !scn.Scan() {
+				break
+			}
+			n++
+			line += strings.TrimLeft(scn.Text(), " \t\f")
+		}
+		k, v, err := split(line)
+		if err != nil {
+			return nil, SyntaxError{Line: start, Msg: err.Error()}
+		}
+		props[k] = v
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// continued reports whether the line ends with an odd number of backslashes, meaning that the last backslash is not
+// itself escaped and thus continues the logical line.
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// split separates a logical line of a .properties file into its unescaped key and value.
+func split(line string) (string, string, error) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+	key, rest := line[:end], line[end:]
+	rest = strings.TrimLeft(rest, " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	k, err := unescape(key)
+	if err != nil {
+		return "", "", err
+	}
+	v, err := unescape(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return k, v, nil
+}
+
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			break
+		}
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("malformed \\uXXXX escape: %s", s[i-1:])
+			}
+			cp, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\uXXXX escape: %s", s[i-1:i+5])
+			}
+			i += 4
+			r := rune(cp)
+			if utf16.IsSurrogate(r) && strings.HasPrefix(s[i+1:], `\u`) && i+7 <= len(s) {
+				// Characters outside the basic multilingual plane are written as a pair of UTF-16 surrogates.
+				low, err := strconv.ParseUint(s[i+3:i+7], 16, 16)
+				if err == nil && utf16.DecodeRune(r, rune(low)) != utf8.RuneError {
+					r = utf16.DecodeRune(r, rune(low))
+					i += 6
+				}
+			}
+			sb.WriteRune(r)
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			sb.WriteString(s[i : i+size])
+			i += size - 1
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,283 @@
+package properties
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseProperties(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		props map[string]string
+		err   error
+	}{
+		{
+			name: "separators",
+			src: `
+a=1
+b:2
+c 3
+d = 4
+  e  :  5
+f=
+g
+`,
+			props: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": "", "g": ""},
+		},
+		{
+			name: "comments",
+			src: `# comment
+! another comment
+   # indented comment
+key=value # not a comment
+`,
+			props: map[string]string{"key": "value # not a comment"},
+		},
+		{
+			name: "continuation",
+			src: `fruits = apple, \
+         banana, \
+         pear
+path=c:\\windows\\
+next=1
+`,
+			props: map[string]string{"fruits": "apple, banana, pear", "path": `c:\windows\`, "next": "1"},
+		},
+		{
+			name: "escapes",
+			src: `key\ with\ spaces = value
+key\=with\:separators = value
+tab=a\tb
+newline=a\nb
+unicode=\u00e4\u00f6
+emoji=\ud83d\ude00
+quoted="postman-echo.com"
+trailing=value  `,
+			props: map[string]string{
+				"key with spaces":     "value",
+				"key=with:separators": "value",
+				"tab":                 "a\tb",
+				"newline":             "a\nb",
+				"unicode":             "äö",
+				"emoji":               "😀",
+				"quoted":              `"postman-echo.com"`,
+				"trailing":            "value  ",
+			},
+		},
+		{
+			name: "malformed unicode escape",
+			src:  "a=1\nb=\\u12g4\n",
+			err:  SyntaxError{Line: 2, Msg: `malformed \uXXXX escape: \u12g4`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			props, err := ParseProperties(strings.NewReader(test.src))
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.props, props)
+		})
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		props map[string]string
+		err   error
+	}{
+		{
+			name: "unquoted",
+			src: `
+# comment
+A=1
+export B=2
+C = 3  # trailing comment
+D=a#b
+E=
+`,
+			props: map[string]string{"A": "1", "B": "2", "C": "3", "D": "a#b", "E": ""},
+		},
+		{
+			name: "quoted",
+			src: `SINGLE='literal \n $value'
+DOUBLE="escaped\n\"value\""
+HASH="a # b" # comment
+MULTI="first
+second"
+`,
+			props: map[string]string{
+				"SINGLE": `literal \n $value`,
+				"DOUBLE": "escaped\n\"value\"",
+				"HASH":   "a # b",
+				"MULTI":  "first\nsecond",
+			},
+		},
+		{
+			name: "missing separator",
+			src:  "A=1\nB\n",
+			err:  SyntaxError{Line: 2, Msg: "expected KEY=VALUE"},
+		},
+		{
+			name: "unterminated quote",
+			src:  "A=1\nB=\"open\nC=2\n",
+			err:  SyntaxError{Line: 2, Msg: "unterminated quoted value"},
+		},
+		{
+			name: "trailing characters",
+			src:  "A='a'b\n",
+			err:  SyntaxError{Line: 1, Msg: "unexpected characters after closing quote"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			props, err := ParseDotenv(strings.NewReader(test.src))
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.props, props)
+		})
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		props map[string]string
+		err   error
+	}{
+		{
+			name: "nested yaml",
+			src: `
+target:
+  host: postman-echo.com
+  port: 443
+  secure: true
+isbn: "0-19-852663-6"
+empty: ~
+hosts:
+  - a.example.com
+  - name: b
+`,
+			props: map[string]string{
+				"target.host":   "postman-echo.com",
+				"target.port":   "443",
+				"target.secure": "true",
+				"isbn":          "0-19-852663-6",
+				"empty":         "",
+				"hosts.0":       "a.example.com",
+				"hosts.1.name":  "b",
+			},
+		},
+		{
+			name: "merge keys",
+			src: `
+base: &base
+  host: localhost
+staging:
+  <<: *base
+  port: 8080
+`,
+			props: map[string]string{
+				"base.host":    "localhost",
+				"staging.host": "localhost",
+				"staging.port": "8080",
+			},
+		},
+		{
+			name: "merged sequence",
+			src: `
+a: &a
+  x: 1
+  z: 1
+b: &b
+  y: 2
+  z: 2
+c:
+  <<: [*a, *b]
+  w: 3
+`,
+			props: map[string]string{
+				"a.x": "1", "a.z": "1",
+				"b.y": "2", "b.z": "2",
+				"c.x": "1", "c.y": "2", "c.z": "1", "c.w": "3",
+			},
+		},
+		{
+			name: "explicit keys take precedence over merged keys",
+			src: `
+a: &a
+  x: 1
+  y: 1
+d:
+  x: 9
+  <<: *a
+`,
+			props: map[string]string{
+				"a.x": "1", "a.y": "1",
+				"d.x": "9", "d.y": "1",
+			},
+		},
+		{
+			name: "merging a scalar",
+			src:  "a: 1\nb:\n  <<: 2\n",
+			err:  SyntaxError{Line: 3, Msg: "only mappings can be merged"},
+		},
+		{
+			name:  "json",
+			src:   `{"target": {"host": "postman-echo.com", "port": 1.50}}`,
+			props: map[string]string{"target.host": "postman-echo.com", "target.port": "1.50"},
+		},
+		{
+			name:  "empty",
+			src:   "",
+			props: map[string]string{},
+		},
+		{
+			name: "not a mapping",
+			src:  "\n- a\n- b\n",
+			err:  SyntaxError{Line: 2, Msg: "document must be a mapping"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			props, err := ParseYAML(strings.NewReader(test.src))
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.props, props)
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.properties": "host=localhost\n",
+		".env":           "host=localhost\n",
+		"staging.env":    "export host=localhost\n",
+		"app.yml":        "host: localhost\n",
+		"app.json":       `{"host": "localhost"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0o644))
+		assert.True(t, Supported(name))
+		props, err := ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"host": "localhost"}, props)
+	}
+
+	path := filepath.Join(dir, "broken.properties")
+	assert.Nil(t, os.WriteFile(path, []byte(`a=\u00`), 0o644))
+	_, err := ReadFile(path)
+	var syntax SyntaxError
+	assert.ErrorAs(t, err, &syntax)
+	assert.Equal(t, 1, syntax.Line)
+	assert.Contains(t, err.Error(), "broken.properties")
+
+	assert.False(t, Supported("app.txt"))
+	_, err = ReadFile(filepath.Join(dir, "app.txt"))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
@@ -0,0 +1,79 @@
+package properties
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crookdc/pia/internal/yamlnode"
+	"gopkg.in/yaml.v3"
+	"io"
+	"strconv"
+)
+
+// ParseYAML reads properties from a YAML or JSON document. The document must be a mapping, nested mappings and
+// sequences are flattened using dotted keys where items of sequences are addressed by their index. Scalars keep the
+// textual representation they have in the document, null values are read as empty strings.
+func ParseYAML(r io.Reader) (map[string]string, error) {
+	var doc yaml.Node
+	err := yaml.NewDecoder(r).Decode(&doc)
+	if errors.Is(err, io.EOF) {
+		return make(map[string]string), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	root := &doc
+	if root.Kind == yaml.DocumentNode {
+		root = root.Content[0]
+	}
+	if yamlnode.Resolve(root).Kind != yaml.MappingNode {
+		return nil, SyntaxError{Line: root.Line, Msg: "document must be a mapping"}
+	}
+	props := make(map[string]string)
+	if err := flatten(props, "", root); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func flatten(props map[string]string, prefix string, node *yaml.Node) error {
+	node = yamlnode.Resolve(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		// Merge keys ("<<: *anchor") inline the properties of other mappings into this one.
+		pairs, err := yamlnode.MappingPairs(node)
+		if err != nil {
+			var walk yamlnode.Error
+			if errors.As(err, &walk) {
+				return SyntaxError{Line: walk.Line, Msg: walk.Msg}
+			}
+			return err
+		}
+		for _, pair := range pairs {
+			if err := flatten(props, join(prefix, pair.Key.Value), pair.Value); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if err := flatten(props, join(prefix, strconv.Itoa(i)), item); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			props[prefix] = ""
+			return nil
+		}
+		props[prefix] = node.Value
+	default:
+		return SyntaxError{Line: node.Line, Msg: fmt.Sprintf("unexpected node kind %d", node.Kind)}
+	}
+	return nil
+}
+
+func join(prefix, k string) string {
+	if prefix == "" {
+		return k
+	}
+	return prefix + "." + k
+}
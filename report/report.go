@@ -0,0 +1,240 @@
+// Package report turns the summary of running a collection of transactions into machine-readable reports that can be
+// consumed by CI systems and dashboards.
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/crookdc/pia"
+	"io"
+	"time"
+)
+
+// Reporter writes a report of the provided [pia.Summary] to the provided [io.Writer].
+type Reporter func(io.Writer, *pia.Summary) error
+
+// Reporters contains every built-in [report.Reporter] keyed by the name of the format it produces.
+var Reporters = map[string]Reporter{
+	"junit": JUnit,
+	"tap":   TAP,
+	"json":  JSON,
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit writes the summary as JUnit XML. Each transaction becomes a test suite containing one test case for the
+// transaction itself followed by one test case for each assertion made by its hooks.
+func JUnit(w io.Writer, summary *pia.Summary) error {
+	doc := junitSuites{
+		Time:   seconds(summary.Duration),
+		Suites: make([]junitSuite, 0, len(summary.Results)),
+	}
+	for _, res := range summary.Results {
+		suite := junitSuite{
+			Name: res.Path,
+			Time: seconds(res.Duration),
+		}
+		tc := junitCase{
+			Name:      res.Path,
+			ClassName: res.Path,
+			Time:      seconds(res.Duration),
+		}
+		switch res.Status {
+		case pia.Failed:
+			tc.Failure = &junitProblem{Message: res.Err.Error(), Type: "assertion", Text: res.Err.Error()}
+			suite.Failures++
+		case pia.Errored:
+			tc.Error = &junitProblem{Message: res.Err.Error(), Type: "error", Text: res.Err.Error()}
+			suite.Errors++
+		}
+		suite.Cases = append(suite.Cases, tc)
+		for _, a := range res.Assertions {
+			tc := junitCase{
+				Name:      a.Message,
+				ClassName: res.Path,
+				Time:      seconds(0),
+			}
+			if !a.Passed() {
+				tc.Failure = &junitProblem{Message: a.Err.Error(), Type: "assertion", Text: a.Err.Error()}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Tests = len(suite.Cases)
+		doc.Tests += suite.Tests
+		doc.Failures += suite.Failures
+		doc.Errors += suite.Errors
+		doc.Suites = append(doc.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// TAP writes the summary using the Test Anything Protocol version 13. Each assertion made by the hooks of a transaction
+// becomes a test point of its own, followed by a test point for the transaction itself.
+func TAP(w io.Writer, summary *pia.Summary) error {
+	points := 0
+	for _, res := range summary.Results {
+		points += len(res.Assertions) + 1
+	}
+	if _, err := fmt.Fprintf(w, "TAP version 13\n1..%d\n", points); err != nil {
+		return err
+	}
+	n := 0
+	point := func(ok bool, description string, diagnostics map[string]string) error {
+		n++
+		status := "ok"
+		if !ok {
+			status = "not ok"
+		}
+		if _, err := fmt.Fprintf(w, "%s %d - %s\n", status, n, description); err != nil {
+			return err
+		}
+		if len(diagnostics) == 0 {
+			return nil
+		}
+		if _, err := io.WriteString(w, "  ---\n"); err != nil {
+			return err
+		}
+		for _, k := range []string{"message", "severity", "duration_ms"} {
+			v, ok := diagnostics[k]
+			if !ok {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "  %s: %q\n", k, v); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "  ...\n")
+		return err
+	}
+	for _, res := range summary.Results {
+		for _, a := range res.Assertions {
+			var diagnostics map[string]string
+			if !a.Passed() {
+				diagnostics = map[string]string{"message": a.Err.Error(), "severity": "fail"}
+			}
+			if err := point(a.Passed(), fmt.Sprintf("%s: %s", res.Path, a.Message), diagnostics); err != nil {
+				return err
+			}
+		}
+		var diagnostics map[string]string
+		if res.Err != nil {
+			severity := "fail"
+			if res.Status == pia.Errored {
+				severity = "error"
+			}
+			diagnostics = map[string]string{
+				"message":     res.Err.Error(),
+				"severity":    severity,
+				"duration_ms": fmt.Sprint(res.Duration.Milliseconds()),
+			}
+		}
+		if err := point(res.Status == pia.Passed, res.Path, diagnostics); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonReport struct {
+	Duration     int64             `json:"duration_ms"`
+	Passed       int               `json:"passed"`
+	Failed       int               `json:"failed"`
+	Errored      int               `json:"errored"`
+	Transactions []jsonTransaction `json:"transactions"`
+}
+
+type jsonTransaction struct {
+	Path       string          `json:"path"`
+	Status     string          `json:"status"`
+	Duration   int64           `json:"duration_ms"`
+	Error      string          `json:"error,omitempty"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Assertions []jsonAssertion `json:"assertions"`
+}
+
+type jsonAssertion struct {
+	Message string `json:"message"`
+	Passed  bool   `json:"passed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// JSON writes the summary as a single JSON document.
+func JSON(w io.Writer, summary *pia.Summary) error {
+	doc := jsonReport{
+		Duration:     summary.Duration.Milliseconds(),
+		Passed:       summary.Count(pia.Passed),
+		Failed:       summary.Count(pia.Failed),
+		Errored:      summary.Count(pia.Errored),
+		Transactions: make([]jsonTransaction, 0, len(summary.Results)),
+	}
+	for _, res := range summary.Results {
+		tx := jsonTransaction{
+			Path:       res.Path,
+			Status:     res.Status.String(),
+			Duration:   res.Duration.Milliseconds(),
+			Assertions: make([]jsonAssertion, 0, len(res.Assertions)),
+		}
+		if res.Err != nil {
+			tx.Error = res.Err.Error()
+		}
+		if res.Response != nil {
+			tx.StatusCode = res.Response.StatusCode
+		}
+		for _, a := range res.Assertions {
+			ja := jsonAssertion{Message: a.Message, Passed: a.Passed()}
+			if a.Err != nil {
+				ja.Error = a.Err.Error()
+			}
+			tx.Assertions = append(tx.Assertions, ja)
+		}
+		doc.Transactions = append(doc.Transactions, tx)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,127 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/squeak"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func summary() *pia.Summary {
+	failed := fmt.Errorf("%w: expected created", squeak.ErrFailedAssertion)
+	return &pia.Summary{
+		Duration: 1500 * time.Millisecond,
+		Results: []pia.Result{
+			{
+				Path:       "login.yml",
+				Status:     pia.Passed,
+				Duration:   time.Second,
+				Response:   &http.Response{StatusCode: http.StatusOK},
+				Assertions: []squeak.Assertion{{Message: "expected ok"}},
+			},
+			{
+				Path:       "users/create.yml",
+				Status:     pia.Failed,
+				Err:        failed,
+				Duration:   250 * time.Millisecond,
+				Response:   &http.Response{StatusCode: http.StatusOK},
+				Assertions: []squeak.Assertion{{Message: "expected created", Err: failed}},
+			},
+			{
+				Path:     "users/list.yml",
+				Status:   pia.Errored,
+				Err:      fmt.Errorf("connection refused"),
+				Duration: 250 * time.Millisecond,
+			},
+		},
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, JUnit(buf, summary()))
+	var doc junitSuites
+	assert.Nil(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, 5, doc.Tests)
+	assert.Equal(t, 2, doc.Failures)
+	assert.Equal(t, 1, doc.Errors)
+	assert.Equal(t, "1.500", doc.Time)
+	assert.Len(t, doc.Suites, 3)
+	assert.Equal(t, "users/create.yml", doc.Suites[1].Name)
+	assert.Equal(t, "expected created", doc.Suites[1].Cases[1].Name)
+	assert.Equal(t, "runtime error: assertion failed: expected created", doc.Suites[1].Cases[1].Failure.Message)
+	assert.Equal(t, "connection refused", doc.Suites[2].Cases[0].Error.Message)
+}
+
+func TestTAP(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, TAP(buf, summary()))
+	assert.Equal(t, `TAP version 13
+1..5
+ok 1 - login.yml: expected ok
+ok 2 - login.yml
+not ok 3 - users/create.yml: expected created
+  ---
+  message: "runtime error: assertion failed: expected created"
+  severity: "fail"
+  ...
+not ok 4 - users/create.yml
+  ---
+  message: "runtime error: assertion failed: expected created"
+  severity: "fail"
+  duration_ms: "250"
+  ...
+not ok 5 - users/list.yml
+  ---
+  message: "connection refused"
+  severity: "error"
+  duration_ms: "250"
+  ...
+`, buf.String())
+}
+
+func TestJSON(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, JSON(buf, summary()))
+	var doc jsonReport
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, jsonReport{
+		Duration: 1500,
+		Passed:   1,
+		Failed:   1,
+		Errored:  1,
+		Transactions: []jsonTransaction{
+			{
+				Path:       "login.yml",
+				Status:     "passed",
+				Duration:   1000,
+				StatusCode: http.StatusOK,
+				Assertions: []jsonAssertion{{Message: "expected ok", Passed: true}},
+			},
+			{
+				Path:       "users/create.yml",
+				Status:     "failed",
+				Duration:   250,
+				Error:      "runtime error: assertion failed: expected created",
+				StatusCode: http.StatusOK,
+				Assertions: []jsonAssertion{{
+					Message: "expected created",
+					Error:   "runtime error: assertion failed: expected created",
+				}},
+			},
+			{
+				Path:       "users/list.yml",
+				Status:     "errored",
+				Duration:   250,
+				Error:      "connection refused",
+				Assertions: []jsonAssertion{},
+			},
+		},
+	}, doc)
+}
@@ -6,17 +6,37 @@ import (
 	"strings"
 )
 
+// DelegatingKeyResolver resolves keys of the form "prefix:key" by delegating the key to the [pia.KeyResolver] that is
+// registered for the prefix.
 type DelegatingKeyResolver struct {
 	Delegates map[string]KeyResolver
+	// Default is the prefix of the delegate used to resolve keys that carry no prefix. If empty, keys without a prefix
+	// cannot be resolved.
+	Default string
 }
 
 func (d DelegatingKeyResolver) Resolve(k string) (string, error) {
-	sections := strings.SplitN(k, ":", 2)
-	delegate, ok := d.Delegates[sections[0]]
+	prefix, key, ok := strings.Cut(k, ":")
 	if !ok {
-		return "", fmt.Errorf("%w: %s is not a valid delegate", ErrKeyNotFound, sections[0])
+		if d.Default == "" {
+			return "", fmt.Errorf("%w: %s has no prefix and there is no default delegate", ErrKeyNotFound, k)
+		}
+		prefix, key = d.Default, k
+	}
+	delegate, ok := d.Delegates[prefix]
+	if !ok {
+		return "", fmt.Errorf("%w: %s is not a valid delegate", ErrKeyNotFound, prefix)
+	}
+	return delegate.Resolve(key)
+}
+
+// Reset implements the [pia.Resetter] interface by resetting every delegate which implements it.
+func (d DelegatingKeyResolver) Reset() {
+	for _, delegate := range d.Delegates {
+		if r, ok := delegate.(Resetter); ok {
+			r.Reset()
+		}
 	}
-	return delegate.Resolve(sections[1])
 }
 
 type EnvironmentResolver struct{}
@@ -36,6 +56,43 @@ type KeyResolver interface {
 	Resolve(k string) (string, error)
 }
 
+// Relocate implements the [pia.Relocatable] interface by relocating every delegate which implements it.
+func (d DelegatingKeyResolver) Relocate(wd string) KeyResolver {
+	delegates := make(map[string]KeyResolver, len(d.Delegates))
+	for prefix, delegate := range d.Delegates {
+		if r, ok := delegate.(Relocatable); ok {
+			delegate = r.Relocate(wd)
+		}
+		delegates[prefix] = delegate
+	}
+	return DelegatingKeyResolver{Delegates: delegates, Default: d.Default}
+}
+
+// Secrets implements the [pia.SecretKeeper] interface by collecting the secrets of every delegate which implements it.
+func (d DelegatingKeyResolver) Secrets() []string {
+	var secrets []string
+	for _, delegate := range d.Delegates {
+		if k, ok := delegate.(SecretKeeper); ok {
+			secrets = append(secrets, k.Secrets()...)
+		}
+	}
+	return secrets
+}
+
+// Relocatable is implemented by a [pia.KeyResolver] which resolves keys relative to a working directory, such as
+// paths to files.
+type Relocatable interface {
+	// Relocate returns a copy of the resolver which resolves keys relative to wd.
+	Relocate(wd string) KeyResolver
+}
+
+// Resetter is implemented by a [pia.KeyResolver] holding state which should only live for the duration of a single
+// transaction, such as memoized values.
+type Resetter interface {
+	// Reset discards any state accumulated while resolving keys.
+	Reset()
+}
+
 // MapResolver is the simplest possible implementation of [pia.KeyResolver] using an underlying map to facilitate
 // storage and retrieval.
 type MapResolver map[string]string
@@ -10,6 +10,7 @@ func TestDelegatingKeyResolver_Resolve(t *testing.T) {
 	tests := []struct {
 		key       string
 		delegates map[string]pia.KeyResolver
+		fallback  string
 		value     string
 		err       error
 	}{
@@ -58,11 +59,31 @@ func TestDelegatingKeyResolver_Resolve(t *testing.T) {
 			},
 			err: pia.ErrKeyNotFound,
 		},
+		{
+			key: "id_token",
+			delegates: map[string]pia.KeyResolver{
+				"session": pia.MapResolver{
+					"id_token": "abc",
+				},
+			},
+			err: pia.ErrKeyNotFound,
+		},
+		{
+			key: "id_token",
+			delegates: map[string]pia.KeyResolver{
+				"session": pia.MapResolver{
+					"id_token": "abc",
+				},
+			},
+			fallback: "session",
+			value:    "abc",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.key, func(t *testing.T) {
 			value, err := pia.DelegatingKeyResolver{
 				Delegates: test.delegates,
+				Default:   test.fallback,
 			}.Resolve(test.key)
 			assert.ErrorIs(t, err, test.err)
 			assert.Equal(t, test.value, value)
@@ -0,0 +1,267 @@
+package pia
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/crookdc/pia/squeak"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Manifest is the name of the file which, when present in the root of a collection, defines which transactions the
+// collection consists of and in what order they are executed.
+const Manifest = "manifest.yml"
+
+// Status describes the outcome of executing a single transaction as part of a collection.
+type Status int
+
+const (
+	// Passed denotes a transaction that was executed without any errors and whose hooks held all assertions.
+	Passed Status = iota
+	// Failed denotes a transaction where an assertion made in one of its hooks did not hold.
+	Failed
+	// Errored denotes a transaction that could not be executed to completion for any reason other than a failed
+	// assertion.
+	Errored
+)
+
+func (s Status) String() string {
+	switch s {
+	case Passed:
+		return "passed"
+	case Failed:
+		return "failed"
+	case Errored:
+		return "errored"
+	default:
+		return fmt.Sprintf("status(%d)", int(s))
+	}
+}
+
+// Result is the outcome of executing a single transaction as part of a collection.
+type Result struct {
+	// Path is the path of the transaction file relative to the root of the collection.
+	Path     string
+	Status   Status
+	Err      error
+	Duration time.Duration
+	// Response is the response received for the transaction, if any. The body of the response is buffered in memory
+	// and can therefore be read even after the runner has moved on to the next transaction.
+	Response *http.Response
+	// Assertions contains every assertion made by the hooks of the transaction.
+	Assertions []squeak.Assertion
+}
+
+// Summary is the aggregated outcome of running a collection of transactions.
+type Summary struct {
+	Results  []Result
+	Duration time.Duration
+}
+
+// Count returns the number of results in the summary that have the provided status.
+func (s *Summary) Count(status Status) int {
+	n := 0
+	for _, res := range s.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Runner executes collections of transactions. Every transaction is executed by a fork of the same [squeak.Interpreter],
+// which allows objects declared into its runtime to carry state from the hooks of one transaction to the next while the
+// imports of each transaction are resolved against its own directory.
+type Runner struct {
+	Resolver KeyResolver
+	// Interpreter is forked by [squeak.Interpreter.Fork] to execute the hooks of every transaction. If nil, an
+	// interpreter which discards all output is created upon running the collection.
+	Interpreter *squeak.Interpreter
+	// Callback is invoked with the result of each transaction as soon as it has been executed. It may be nil.
+	Callback func(Result)
+	// Options are passed to [pia.ReadTransaction] when reading each transaction.
+	Options []TransactionOpt
+	// Filters are registered with every [pia.Interpolator] reading the transactions, in addition to the filters returned
+	// by [pia.DefaultFilters].
+	Filters Filters
+	// Context, Client, Clients, Transport and Session are passed to [pia.Transaction.Execute] when executing each
+	// transaction, see [pia.ExecuteOptions]. The run stops once the context is done, leaving the remaining transactions
+	// out of the summary. If Clients is nil, the clients are shared for the duration of each run and closed once it is
+	// done.
+	Context   context.Context
+	Client    *http.Client
+	Clients   *Clients
+	Transport http.RoundTripper
+	Session   *Session
+}
+
+// Run executes the transactions denoted by path, which is either a single transaction file or a directory containing
+// a collection of transactions. A non-nil error is only returned if the collection itself cannot be read, errors that
+// occur while executing individual transactions are reported through the results of the returned [pia.Summary].
+func (r *Runner) Run(path string) (*Summary, error) {
+	paths, err := Collection(path)
+	if err != nil {
+		return nil, err
+	}
+	root := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+	if r.Interpreter == nil {
+		r.Interpreter = squeak.NewInterpreter(root, io.Discard)
+	}
+	clients := r.Clients
+	if clients == nil {
+		clients = &Clients{}
+		defer clients.Close()
+	}
+	start := time.Now()
+	summary := Summary{Results: make([]Result, 0, len(paths))}
+	for _, p := range paths {
+		if r.Context != nil && r.Context.Err() != nil {
+			break
+		}
+		res := r.execute(p, clients)
+		if rel, err := filepath.Rel(root, p); err == nil {
+			res.Path = rel
+		}
+		summary.Results = append(summary.Results, res)
+		if r.Callback != nil {
+			r.Callback(res)
+		}
+	}
+	summary.Duration = time.Since(start)
+	return &summary, nil
+}
+
+func (r *Runner) execute(path string, clients *Clients) (res Result) {
+	res.Path = path
+	start := time.Now()
+	var in *squeak.Interpreter
+	defer func() {
+		// Squeak scripts are able to panic on purpose, that should not bring down the entire collection.
+		if v := recover(); v != nil {
+			res.Status = Errored
+			res.Err = fmt.Errorf("%w: %v", squeak.ErrRuntimeFault, v)
+		}
+		res.Duration = time.Since(start)
+		if in != nil {
+			res.Assertions = in.Assertions()
+		}
+	}()
+	opts := r.Options
+	if r.Filters != nil {
+		opts = append(slices.Clip(opts), WithInterpolationFilters(r.Filters))
+	}
+	tx, err := ReadTransaction(r.Resolver, path, opts...)
+	if err != nil {
+		res.Status = Errored
+		res.Err = err
+		return res
+	}
+	in = r.Interpreter.Fork(tx.WD)
+	res.Response, res.Err = tx.Execute(ExecuteOptions{
+		Context:     r.Context,
+		Client:      r.Client,
+		Clients:     clients,
+		Transport:   r.Transport,
+		Interpreter: in,
+		Session:     r.Session,
+	})
+	if res.Response != nil && res.Response.Body != nil {
+		body, err := io.ReadAll(res.Response.Body)
+		res.Response.Body.Close()
+		if err != nil && res.Err == nil {
+			res.Err = err
+		}
+		res.Response.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	switch {
+	case res.Err == nil:
+		res.Status = Passed
+	case errors.Is(res.Err, squeak.ErrFailedAssertion):
+		res.Status = Failed
+	default:
+		res.Status = Errored
+	}
+	return res
+}
+
+// Collection returns the paths of the transaction files denoted by path in the order they should be executed. If path
+// points to a regular file then it is returned as is. If path points to a directory containing a [pia.Manifest] then
+// the transactions listed in the manifest are returned in the order they are listed. Otherwise, every YAML file found
+// within the directory and its subdirectories is returned in lexical order. Hidden files and directories are ignored,
+// and so is the [pia.EnvironmentsDir] of the directory since a workspace may be run as a collection. Any other YAML
+// file which is not a transaction, such as a fixture, must be kept out of the directory or left out by a manifest.
+func Collection(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	manifest, err := os.Open(filepath.Join(path, Manifest))
+	if err == nil {
+		defer manifest.Close()
+		return manifested(path, manifest)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var paths []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != path && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && p == filepath.Join(path, EnvironmentsDir) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() == Manifest || !IsTransactionFile(d.Name()) {
+			return nil
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+func manifested(root string, r io.Reader) ([]string, error) {
+	var manifest struct {
+		Transactions []string `yaml:"transactions"`
+	}
+	if err := yaml.NewDecoder(r).Decode(&manifest); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	paths := make([]string, len(manifest.Transactions))
+	for i, p := range manifest.Transactions {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(root, p)
+		}
+		paths[i] = p
+	}
+	return paths, nil
+}
+
+// IsTransactionFile reports whether the provided file name carries an extension used for transaction files.
+func IsTransactionFile(name string) bool {
+	return strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".yaml")
+}
@@ -0,0 +1,201 @@
+package pia_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/squeak"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCollection(t *testing.T) {
+	t.Run("lexical order", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range []string{
+			"b.yml", "a.yaml", "sub/c.yml", "notes.txt", ".hidden/d.yml", "environments/dev.yml", "sub/environments/e.yml",
+		} {
+			write(t, filepath.Join(dir, name), "")
+		}
+		paths, err := pia.Collection(dir)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(dir, "a.yaml"),
+			filepath.Join(dir, "b.yml"),
+			filepath.Join(dir, "sub", "c.yml"),
+			filepath.Join(dir, "sub", "environments", "e.yml"),
+		}, paths)
+	})
+	t.Run("manifest order", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "a.yml"), "")
+		write(t, filepath.Join(dir, "b.yml"), "")
+		write(t, filepath.Join(dir, pia.Manifest), "transactions:\n  - b.yml\n  - a.yml\n")
+		paths, err := pia.Collection(dir)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(dir, "b.yml"),
+			filepath.Join(dir, "a.yml"),
+		}, paths)
+	})
+}
+
+func TestRunner_Run(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "1-login.yml"), fmt.Sprintf(`
+method: GET
+url:
+  target: %s
+hooks:
+  after:
+    inline: |
+      shared.token = "abc";
+`, srv.URL))
+	write(t, filepath.Join(dir, "2-passing.yml"), fmt.Sprintf(`
+method: GET
+url:
+  target: %s
+hooks:
+  after:
+    inline: |
+      assert(shared.token == "abc", "token should be shared between transactions");
+`, srv.URL))
+	write(t, filepath.Join(dir, "3-failing.yml"), fmt.Sprintf(`
+method: GET
+url:
+  target: %s
+hooks:
+  after:
+    inline: |
+      assert(response.status_code == 201, "expected created");
+`, srv.URL))
+	write(t, filepath.Join(dir, "4-panicking.yml"), fmt.Sprintf(`
+method: GET
+url:
+  target: %s
+hooks:
+  after:
+    inline: |
+      panic("oh no");
+`, srv.URL))
+	write(t, filepath.Join(dir, "5-unresolvable.yml"), `
+method: GET
+url:
+  target: ${props:missing}
+`)
+
+	in := squeak.NewInterpreter(dir, io.Discard)
+	in.Declare("shared", &squeak.ObjectInstance{Properties: make(map[string]squeak.Object)})
+	var called int
+	runner := pia.Runner{
+		Resolver:    pia.MapResolver{},
+		Interpreter: in,
+		Callback: func(pia.Result) {
+			called++
+		},
+	}
+	summary, err := runner.Run(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, called)
+	statuses := make(map[string]pia.Status)
+	assertions := make(map[string]int)
+	for _, res := range summary.Results {
+		statuses[res.Path] = res.Status
+		assertions[res.Path] = len(res.Assertions)
+	}
+	assert.Equal(t, map[string]pia.Status{
+		"1-login.yml":        pia.Passed,
+		"2-passing.yml":      pia.Passed,
+		"3-failing.yml":      pia.Failed,
+		"4-panicking.yml":    pia.Errored,
+		"5-unresolvable.yml": pia.Errored,
+	}, statuses)
+	assert.Equal(t, map[string]int{
+		"1-login.yml":        0,
+		"2-passing.yml":      1,
+		"3-failing.yml":      1,
+		"4-panicking.yml":    0,
+		"5-unresolvable.yml": 0,
+	}, assertions)
+	assert.Equal(t, 2, summary.Count(pia.Passed))
+	assert.Equal(t, 1, summary.Count(pia.Failed))
+	assert.Equal(t, 2, summary.Count(pia.Errored))
+}
+
+func TestRunner_Run_imports(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	for _, name := range []string{"users", "orders"} {
+		write(t, filepath.Join(dir, name, "greet.sqk"), fmt.Sprintf("print(%q);\n", name))
+		write(t, filepath.Join(dir, name, "list.yml"), fmt.Sprintf(`
+method: GET
+url:
+  target: %s
+hooks:
+  after:
+    inline: |
+      import "greet.sqk";
+`, srv.URL))
+	}
+	var out bytes.Buffer
+	runner := pia.Runner{Resolver: pia.MapResolver{}, Interpreter: squeak.NewInterpreter(dir, &out)}
+	summary, err := runner.Run(dir)
+	assert.Nil(t, err)
+	for _, res := range summary.Results {
+		assert.Nil(t, res.Err, res.Path)
+	}
+	assert.Equal(t, 2, summary.Count(pia.Passed))
+	assert.Equal(t, "ordersusers", out.String())
+}
+
+func TestRunner_Run_filters(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "users.yml"), fmt.Sprintf(`
+method: GET
+url:
+  target: %s/${props:name | reverse}
+`, srv.URL))
+	runner := pia.Runner{
+		Resolver: pia.MapResolver{"props:name": "pia"},
+		Filters: pia.Filters{
+			"reverse": func(s string) (string, error) {
+				runes := []rune(s)
+				slices.Reverse(runes)
+				return string(runes), nil
+			},
+		},
+	}
+	summary, err := runner.Run(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.Count(pia.Passed))
+	assert.Equal(t, "/aip", path)
+}
+
+func write(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package pia
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// kdfIterations is the number of PBKDF2 iterations used when deriving encryption keys from passphrases.
+const kdfIterations = 600_000
+
+var ErrSealed = errors.New("sealed data cannot be opened")
+
+// sealer encrypts and decrypts data using AES-256-GCM with a key derived from a passphrase. The salt used to derive the
+// key must be stored alongside the sealed data to be able to open it again.
+type sealer struct {
+	salt []byte
+	aead cipher.AEAD
+}
+
+// newSealer derives a key from the passphrase and salt and returns a sealer using it. A random salt is generated if the
+// provided salt is empty.
+func newSealer(passphrase string, salt []byte) (*sealer, error) {
+	if len(salt) == 0 {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{salt: salt, aead: aead}, nil
+}
+
+// seal encrypts plaintext and returns the nonce followed by the ciphertext.
+func (s *sealer) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts data previously produced by seal. An error wrapping [pia.ErrSealed] is returned if the data cannot be
+// authenticated, which is most likely caused by an incorrect passphrase.
+func (s *sealer) open(sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("%w: data is truncated", ErrSealed)
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: incorrect passphrase or corrupted data", ErrSealed)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,380 @@
+package pia
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crookdc/pia/squeak"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// NewSession returns an empty [pia.Session].
+func NewSession() *Session {
+	s := &Session{
+		values:  make(map[string]squeak.Object),
+		secrets: make(map[string]struct{}),
+	}
+	s.saved = s.state()
+	return s
+}
+
+// Session is a store of values which lives across transactions. It is exposed to Squeak scripts as an object, which
+// allows hooks to capture values such as tokens from one response, and it implements [pia.KeyResolver] so that the
+// captured values can be interpolated into later transactions.
+//
+// Besides regular property assignment, Squeak scripts can call session.secret(key, value) to store a value which is
+// marked as secret. Once a key has been marked as secret it remains so until it is removed from the session.
+type Session struct {
+	mu      sync.RWMutex
+	values  map[string]squeak.Object
+	secrets map[string]struct{}
+	dirty   bool
+	// saved is the state of the session when it was last loaded or saved, which tells whether objects stored in the
+	// session have been changed since, such as by assigning session.user.name.
+	saved []byte
+}
+
+// Resolve implements the [pia.KeyResolver] interface. The value is resolved to the string representation of the object
+// stored in the session.
+func (s *Session) Resolve(k string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[k]
+	if !ok || v == nil {
+		return "", fmt.Errorf("%w: %s is not in session", ErrKeyNotFound, k)
+	}
+	return v.String(), nil
+}
+
+// Get implements the [squeak.Instance] interface. The key "secret" always resolves to the method used to store secret
+// values.
+func (s *Session) Get(k string) squeak.Object {
+	if k == "secret" {
+		return secretMethod{session: s}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[k]
+}
+
+// Put implements the [squeak.Instance] interface. Putting a nil value removes the key from the session.
+func (s *Session) Put(k string, v squeak.Object) squeak.Object {
+	return s.put(k, v, false)
+}
+
+func (s *Session) put(k string, v squeak.Object, secret bool) squeak.Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty = true
+	if v == nil {
+		delete(s.values, k)
+		delete(s.secrets, k)
+		return nil
+	}
+	s.values[k] = v
+	if secret {
+		s.secrets[k] = struct{}{}
+	}
+	return v
+}
+
+// Secret reports whether the key is marked as secret.
+func (s *Session) Secret(k string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.secrets[k]
+	return ok
+}
+
+// Secrets implements the [pia.SecretKeeper] interface by returning the string representation of every value marked as
+// secret.
+func (s *Session) Secrets() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	secrets := make([]string, 0, len(s.secrets))
+	for k := range s.secrets {
+		secrets = append(secrets, s.values[k].String())
+	}
+	return secrets
+}
+
+// Dirty reports whether the session has been changed since it was last loaded or saved, including changes made to the
+// objects and lists stored in the session.
+func (s *Session) Dirty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dirty || !bytes.Equal(s.state(), s.saved)
+}
+
+// state returns the values of the session encoded as JSON, or nil if any of them cannot be encoded. The caller must
+// hold the lock of the session.
+func (s *Session) state() []byte {
+	values := make(map[string]json.RawMessage, len(s.values))
+	for k, v := range s.values {
+		encoded, err := squeak.MarshalJSON(v)
+		if err != nil {
+			return nil
+		}
+		values[k] = encoded
+	}
+	state, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// Clone implements the [squeak.Object] interface. The clone is a regular object which is detached from the session.
+func (s *Session) Clone() squeak.Object {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	props := make(map[string]squeak.Object, len(s.values))
+	for k, v := range s.values {
+		if v != nil {
+			v = v.Clone()
+		}
+		props[k] = v
+	}
+	return &squeak.ObjectInstance{Properties: props}
+}
+
+func (s *Session) String() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sb := strings.Builder{}
+	sb.WriteString("Session {")
+	for i, k := range slices.Sorted(maps.Keys(s.values)) {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(fmt.Sprintf("%s: %s", k, s.values[k]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// Keys returns the keys stored in the session in lexical order.
+func (s *Session) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Sorted(maps.Keys(s.values))
+}
+
+// secretMethod is exposed to Squeak scripts as session.secret(key, value).
+type secretMethod struct {
+	session *Session
+}
+
+func (m secretMethod) String() string {
+	return "builtin:session:secret"
+}
+
+func (m secretMethod) Clone() squeak.Object {
+	return secretMethod{session: m.session}
+}
+
+func (m secretMethod) Arity() int {
+	return 2
+}
+
+func (m secretMethod) Call(_ *squeak.Interpreter, args ...squeak.Object) (squeak.Object, error) {
+	k, ok := args[0].(squeak.String)
+	if !ok {
+		return nil, fmt.Errorf("%w: session key must be a string", squeak.ErrIllegalArgument)
+	}
+	return m.session.put(k.String(), args[1], true), nil
+}
+
+// SessionStore persists named sessions as JSON files within a directory, one file per session.
+type SessionStore struct {
+	Dir string
+	// Passphrase is used to encrypt values marked as secret before they are written to disk. If empty, secret values
+	// are stored in plain text.
+	Passphrase string
+}
+
+// sessionVersion is the version of the session files written by [pia.SessionStore.Save]. Values of version 0 files are
+// strings, while values of later versions are encoded as JSON, which keeps objects, lists, numbers and booleans intact.
+const sessionVersion = 1
+
+type sessionFile struct {
+	Version int                     `json:"version,omitempty"`
+	Salt    []byte                  `json:"salt,omitempty"`
+	Values  map[string]sessionValue `json:"values"`
+}
+
+type sessionValue struct {
+	// Value is the value encoded as JSON. Since a string is valid JSON, the values of version 0 files are read the same.
+	Value  json.RawMessage `json:"value,omitempty"`
+	Sealed []byte          `json:"sealed,omitempty"`
+	Secret bool            `json:"secret,omitempty"`
+}
+
+// Load reads the named session from disk. A session which has never been saved is returned as an empty session.
+func (st SessionStore) Load(name string) (*Session, error) {
+	path, err := st.path(name)
+	if err != nil {
+		return nil, err
+	}
+	session := NewSession()
+	src, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return session, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file sessionFile
+	if err := json.Unmarshal(src, &file); err != nil {
+		return nil, fmt.Errorf("invalid session file %s: %w", path, err)
+	}
+	var slr *sealer
+	for k, v := range file.Values {
+		value := []byte(v.Value)
+		if v.Sealed != nil {
+			if st.Passphrase == "" {
+				return nil, fmt.Errorf("%w: session %s contains encrypted values but no passphrase was given", ErrSealed, name)
+			}
+			if slr == nil {
+				slr, err = newSealer(st.Passphrase, file.Salt)
+				if err != nil {
+					return nil, err
+				}
+			}
+			plaintext, err := slr.open(v.Sealed)
+			if err != nil {
+				return nil, fmt.Errorf("session %s: %w", name, err)
+			}
+			value = plaintext
+			if file.Version == 0 {
+				value, _ = json.Marshal(string(plaintext))
+			}
+		}
+		if len(value) == 0 {
+			// Version 0 files leave out empty strings.
+			value = []byte(`""`)
+		}
+		var builder squeak.Builder
+		if err := json.Unmarshal(value, &builder); err != nil {
+			return nil, fmt.Errorf("invalid value of %s in session file %s: %w", k, path, err)
+		}
+		session.values[k] = builder.Object()
+		if v.Secret {
+			session.secrets[k] = struct{}{}
+		}
+	}
+	session.saved = session.state()
+	return session, nil
+}
+
+// Save writes the session to disk under the provided name, replacing any previously saved session of the same name.
+func (st SessionStore) Save(name string, session *Session) error {
+	path, err := st.path(name)
+	if err != nil {
+		return err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	file := sessionFile{Version: sessionVersion, Values: make(map[string]sessionValue, len(session.values))}
+	var slr *sealer
+	for k, v := range session.values {
+		_, secret := session.secrets[k]
+		value := sessionValue{Secret: secret}
+		encoded, err := squeak.MarshalJSON(v)
+		if err != nil {
+			return fmt.Errorf("session value %s: %w", k, err)
+		}
+		if secret && st.Passphrase != "" {
+			if slr == nil {
+				slr, err = newSealer(st.Passphrase, nil)
+				if err != nil {
+					return err
+				}
+				file.Salt = slr.salt
+			}
+			value.Sealed, err = slr.seal(encoded)
+			if err != nil {
+				return err
+			}
+		} else {
+			value.Value = encoded
+		}
+		file.Values[k] = value
+	}
+	src, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(path, src); err != nil {
+		return err
+	}
+	session.dirty = false
+	session.saved = session.state()
+	return nil
+}
+
+// List returns the names of every saved session in lexical order.
+func (st SessionStore) List() ([]string, error) {
+	entries, err := os.ReadDir(st.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return names, nil
+}
+
+// Clear removes the named session from disk. Clearing a session which has never been saved is not an error.
+func (st SessionStore) Clear(name string) error {
+	path, err := st.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (st SessionStore) path(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid session name: %q", name)
+	}
+	return filepath.Join(st.Dir, name+".json"), nil
+}
+
+// writeFile writes data to a temporary file next to path before moving it into place, which ensures that the file
+// found at path is never left partially written. The file is only readable by its owner.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,254 @@
+package pia_test
+
+import (
+	"fmt"
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/squeak"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSession_Resolve(t *testing.T) {
+	session := pia.NewSession()
+	_, err := session.Resolve("id_token")
+	assert.ErrorIs(t, err, pia.ErrKeyNotFound)
+
+	in := squeak.NewInterpreter("", io.Discard)
+	in.Declare("session", session)
+	program, err := squeak.ParseString(`
+		session.id_token = "abc";
+		session.removed = "def";
+		session.removed = nil;
+	`)
+	assert.Nil(t, err)
+	assert.Nil(t, in.Execute(program))
+
+	value, err := session.Resolve("id_token")
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", value)
+	_, err = session.Resolve("removed")
+	assert.ErrorIs(t, err, pia.ErrKeyNotFound)
+	assert.Equal(t, []string{"id_token"}, session.Keys())
+}
+
+func TestSession_sharedBetweenTransactions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			_, _ = w.Write([]byte(`{"token": "abc123"}`))
+		default:
+			if r.Header.Get("Authorization") != "Bearer abc123" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "1-login.yml"), fmt.Sprintf(`
+method: POST
+url:
+  target: %s/login
+hooks:
+  after:
+    inline: |
+      session.id_token = response.json().token;
+`, srv.URL))
+	write(t, filepath.Join(dir, "2-protected.yml"), fmt.Sprintf(`
+method: GET
+url:
+  target: %s/protected
+headers:
+  Authorization: Bearer ${session:id_token}
+hooks:
+  after:
+    inline: |
+      assert(response.status_code == 200, "expected to be authorized");
+`, srv.URL))
+
+	session := pia.NewSession()
+	in := squeak.NewInterpreter(dir, io.Discard)
+	in.Declare("session", session)
+	runner := pia.Runner{
+		Resolver: pia.DelegatingKeyResolver{
+			Delegates: map[string]pia.KeyResolver{
+				"session": session,
+			},
+		},
+		Interpreter: in,
+	}
+	summary, err := runner.Run(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, summary.Count(pia.Passed))
+}
+
+func TestSessionStore(t *testing.T) {
+	session := pia.NewSession()
+	in := squeak.NewInterpreter("", io.Discard)
+	in.Declare("session", session)
+	program, err := squeak.ParseString(`
+		session.user = "pia";
+		session.secret("password", "P@$$W0RD");
+	`)
+	assert.Nil(t, err)
+	assert.Nil(t, in.Execute(program))
+	assert.True(t, session.Dirty())
+	assert.True(t, session.Secret("password"))
+	assert.False(t, session.Secret("user"))
+
+	t.Run("plain text", func(t *testing.T) {
+		store := pia.SessionStore{Dir: t.TempDir()}
+		assert.Nil(t, store.Save("default", session))
+		assert.False(t, session.Dirty())
+		src, err := os.ReadFile(filepath.Join(store.Dir, "default.json"))
+		assert.Nil(t, err)
+		assert.Contains(t, string(src), "P@$$W0RD")
+
+		loaded, err := store.Load("default")
+		assert.Nil(t, err)
+		password, err := loaded.Resolve("password")
+		assert.Nil(t, err)
+		assert.Equal(t, "P@$$W0RD", password)
+		assert.True(t, loaded.Secret("password"))
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		store := pia.SessionStore{Dir: t.TempDir(), Passphrase: "correct horse"}
+		assert.Nil(t, store.Save("staging", session))
+		src, err := os.ReadFile(filepath.Join(store.Dir, "staging.json"))
+		assert.Nil(t, err)
+		assert.NotContains(t, string(src), "P@$$W0RD")
+		assert.Contains(t, string(src), `"value": "pia"`)
+
+		loaded, err := store.Load("staging")
+		assert.Nil(t, err)
+		password, err := loaded.Resolve("password")
+		assert.Nil(t, err)
+		assert.Equal(t, "P@$$W0RD", password)
+
+		_, err = pia.SessionStore{Dir: store.Dir, Passphrase: "wrong"}.Load("staging")
+		assert.ErrorIs(t, err, pia.ErrSealed)
+		_, err = pia.SessionStore{Dir: store.Dir}.Load("staging")
+		assert.ErrorIs(t, err, pia.ErrSealed)
+	})
+
+	t.Run("list and clear", func(t *testing.T) {
+		store := pia.SessionStore{Dir: t.TempDir()}
+		names, err := store.List()
+		assert.Nil(t, err)
+		assert.Empty(t, names)
+		assert.Nil(t, store.Save("b", session))
+		assert.Nil(t, store.Save("a", session))
+		names, err = store.List()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a", "b"}, names)
+
+		assert.Nil(t, store.Clear("a"))
+		assert.Nil(t, store.Clear("never-saved"))
+		names, err = store.List()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"b"}, names)
+
+		loaded, err := store.Load("a")
+		assert.Nil(t, err)
+		assert.Empty(t, loaded.Keys())
+		assert.NotNil(t, store.Save("../escape", session))
+	})
+
+	t.Run("structured values", func(t *testing.T) {
+		session := pia.NewSession()
+		in := squeak.NewInterpreter("", io.Discard)
+		in.Declare("session", session)
+		program, err := squeak.ParseString(`
+			session.user = Object { name: "pia", age: 7, admin: true };
+			session.ids = [1, "two"];
+			session.secret("token", Object { value: "abc" });
+		`)
+		assert.Nil(t, err)
+		assert.Nil(t, in.Execute(program))
+		for _, passphrase := range []string{"", "s3cr3t"} {
+			store := pia.SessionStore{Dir: t.TempDir(), Passphrase: passphrase}
+			assert.Nil(t, store.Save("default", session))
+			loaded, err := store.Load("default")
+			assert.Nil(t, err)
+			var out strings.Builder
+			in := squeak.NewInterpreter("", &out)
+			in.Declare("session", loaded)
+			program, err := squeak.ParseString(`
+				print(session.user.name + " " + session.ids[1] + " " + session.token.value);
+				assert(session.user.age == 7, "age");
+				assert(session.user.admin, "admin");
+				assert(session.ids[0] == 1, "ids");
+			`)
+			assert.Nil(t, err)
+			assert.Nil(t, in.Execute(program))
+			assert.Equal(t, "pia two abc", out.String())
+		}
+	})
+
+	t.Run("nested changes", func(t *testing.T) {
+		store := pia.SessionStore{Dir: t.TempDir()}
+		session := pia.NewSession()
+		in := squeak.NewInterpreter("", io.Discard)
+		in.Declare("session", session)
+		program, err := squeak.ParseString(`session.user = Object { name: "pia", roles: ["admin"] };`)
+		assert.Nil(t, err)
+		assert.Nil(t, in.Execute(program))
+		assert.Nil(t, store.Save("default", session))
+
+		loaded, err := store.Load("default")
+		assert.Nil(t, err)
+		assert.False(t, loaded.Dirty())
+		in = squeak.NewInterpreter("", io.Discard)
+		in.Declare("session", loaded)
+		program, err = squeak.ParseString(`
+			session.user.name = "crookdc";
+			session.user.roles[0] = "viewer";
+		`)
+		assert.Nil(t, err)
+		assert.Nil(t, in.Execute(program))
+		assert.True(t, loaded.Dirty())
+		assert.Nil(t, store.Save("default", loaded))
+		assert.False(t, loaded.Dirty())
+
+		reloaded, err := store.Load("default")
+		assert.Nil(t, err)
+		user, err := squeak.MarshalJSON(reloaded.Get("user"))
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"name":"crookdc","roles":["viewer"]}`, string(user))
+	})
+
+	t.Run("version 0 file", func(t *testing.T) {
+		store := pia.SessionStore{Dir: t.TempDir()}
+		assert.Nil(t, os.MkdirAll(store.Dir, 0o755))
+		assert.Nil(t, os.WriteFile(
+			filepath.Join(store.Dir, "old.json"),
+			[]byte(`{"values": {"user": {"value": "{\"name\": \"pia\"}"}, "empty": {}}}`),
+			0o644,
+		))
+		loaded, err := store.Load("old")
+		assert.Nil(t, err)
+		user, err := loaded.Resolve("user")
+		assert.Nil(t, err)
+		assert.Equal(t, `{"name": "pia"}`, user)
+		empty, err := loaded.Resolve("empty")
+		assert.Nil(t, err)
+		assert.Equal(t, "", empty)
+	})
+
+	t.Run("unencodable value", func(t *testing.T) {
+		session := pia.NewSession()
+		in := squeak.NewInterpreter("", io.Discard)
+		in.Declare("session", session)
+		program, err := squeak.ParseString(`session.fn = function() {};`)
+		assert.Nil(t, err)
+		assert.Nil(t, in.Execute(program))
+		assert.ErrorIs(t, pia.SessionStore{Dir: t.TempDir()}.Save("default", session), squeak.ErrIllegalArgument)
+	})
+}
@@ -15,7 +15,7 @@ func (p PrintBuiltin) Arity() int {
 }
 
 func (p PrintBuiltin) Call(in *Interpreter, args ...Object) (Object, error) {
-	_, err := fmt.Fprint(in.out, args[0].String())
+	_, err := fmt.Fprint(in.out, stringOf(args[0]))
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +41,7 @@ func (p PrintlnBuiltin) Arity() int {
 }
 
 func (p PrintlnBuiltin) Call(in *Interpreter, args ...Object) (Object, error) {
-	_, err := fmt.Fprintln(in.out, args[0].String())
+	_, err := fmt.Fprintln(in.out, stringOf(args[0]))
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +110,18 @@ func (p PanicBuiltin) Call(_ *Interpreter, args ...Object) (Object, error) {
 	panic(fmt.Errorf("%w: %s", ErrRuntimeFault, args[0]))
 }
 
+// Assertion is the record of a single call to the assert builtin.
+type Assertion struct {
+	Message string
+	// Err is the error produced by the assertion, it is nil for assertions that held.
+	Err error
+}
+
+// Passed reports whether the assertion held.
+func (a Assertion) Passed() bool {
+	return a.Err == nil
+}
+
 type AssertBuiltin struct{}
 
 func (a AssertBuiltin) String() string {
@@ -125,9 +137,10 @@ func (a AssertBuiltin) Arity() int {
 }
 
 func (a AssertBuiltin) Call(in *Interpreter, args ...Object) (Object, error) {
-	val := Boolean{in.truthy(args[0])}
-	if val.value {
-		return nil, nil
+	rec := Assertion{Message: fmt.Sprint(args[1])}
+	if !in.truthy(args[0]) {
+		rec.Err = fmt.Errorf("%w: %s", ErrFailedAssertion, args[1])
 	}
-	return nil, fmt.Errorf("%w: %s", ErrFailedAssertion, args[1])
+	in.assertions = append(in.assertions, rec)
+	return nil, rec.Err
 }
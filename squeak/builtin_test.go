@@ -12,3 +12,17 @@ func TestPrintBuiltin_Arity(t *testing.T) {
 func TestLengthBuiltin_Arity(t *testing.T) {
 	assert.Equal(t, 1, LengthBuiltin{}.Arity())
 }
+
+func TestAssertBuiltin_Call(t *testing.T) {
+	in := NewInterpreter("", nil)
+	_, err := AssertBuiltin{}.Call(in, Boolean{true}, String{"holds"})
+	assert.Nil(t, err)
+	_, err = AssertBuiltin{}.Call(in, Boolean{false}, String{"does not hold"})
+	assert.ErrorIs(t, err, ErrFailedAssertion)
+	assertions := in.Assertions()
+	assert.Len(t, assertions, 2)
+	assert.Equal(t, Assertion{Message: "holds"}, assertions[0])
+	assert.True(t, assertions[0].Passed())
+	assert.Equal(t, "does not hold", assertions[1].Message)
+	assert.False(t, assertions[1].Passed())
+}
@@ -1,6 +1,7 @@
 package squeak
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/crookdc/pia/squeak/ast"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 )
 
 var (
@@ -125,15 +127,30 @@ func NewInterpreter(wd string, out io.Writer) *Interpreter {
 }
 
 type Interpreter struct {
-	wd      string
-	exports map[string]Object
-	runtime *Environment
-	global  *Environment
-	scope   *Environment
-	out     io.Writer
+	wd         string
+	exports    map[string]Object
+	runtime    *Environment
+	global     *Environment
+	scope      *Environment
+	out        io.Writer
+	assertions []Assertion
+	// ctx, if non-nil, is checked before every statement is executed, see [squeak.Interpreter.ExecuteContext].
+	ctx context.Context
 }
 
 func (in *Interpreter) Execute(program []ast.StatementNode) error {
+	return in.ExecuteContext(context.Background(), program)
+}
+
+// ExecuteContext executes the program like [squeak.Interpreter.Execute], but stops with the error of ctx as soon as ctx
+// is done. The context is checked before every statement, including those in loops, function bodies and imported
+// files, which means that a program which never terminates on its own can still be cancelled.
+func (in *Interpreter) ExecuteContext(ctx context.Context, program []ast.StatementNode) error {
+	parent := in.ctx
+	in.ctx = ctx
+	defer func() {
+		in.ctx = parent
+	}()
 	for _, stmt := range program {
 		uw, err := in.execute(stmt)
 		if err != nil {
@@ -148,6 +165,25 @@ func (in *Interpreter) Execute(program []ast.StatementNode) error {
 	return nil
 }
 
+// Fork returns an interpreter which shares the runtime, global scope and standard output of in, but which resolves the
+// paths of imports against wd. Objects declared by either interpreter are therefore visible to the other, while the
+// assertions made by the returned interpreter are recorded separately from those made by in.
+func (in *Interpreter) Fork(wd string) *Interpreter {
+	return &Interpreter{
+		wd:      wd,
+		exports: make(map[string]Object),
+		runtime: in.runtime,
+		global:  in.global,
+		scope:   in.global,
+		out:     in.out,
+	}
+}
+
+// Assertions returns a record of every assertion made by the interpreter so far, in the order they were made.
+func (in *Interpreter) Assertions() []Assertion {
+	return slices.Clone(in.assertions)
+}
+
 func (in *Interpreter) Declare(name string, obj Object) {
 	in.runtime.Declare(name, obj)
 }
@@ -162,6 +198,11 @@ func (in *Interpreter) Resolve(name string, lvl int) (Object, bool) {
 // handled by this method. Instead, whenever an unwinding statement is encountered then a non-nil value of unwinder is
 // returned which is expected to be processed properly by some caller in the call stack.
 func (in *Interpreter) execute(stmt ast.StatementNode) (*unwinder, error) {
+	if in.ctx != nil {
+		if err := in.ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
 	switch stmt := stmt.(type) {
 	case ast.ExpressionStatement:
 		_, err := in.evaluate(stmt.Expression)
@@ -209,7 +250,7 @@ func (in *Interpreter) execute(stmt ast.StatementNode) (*unwinder, error) {
 			return nil, err
 		}
 		child := NewInterpreter(filepath.Dir(loc), in.out)
-		if err := child.Execute(stmts); err != nil {
+		if err := child.ExecuteContext(in.ctx, stmts); err != nil {
 			return nil, err
 		}
 		// Declare any exported variables to the current scope. This allows users to limit the scope in which exported
@@ -2,12 +2,14 @@ package squeak
 
 import (
 	"bytes"
+	"context"
 	"github.com/crookdc/pia/squeak/ast"
 	"github.com/crookdc/pia/squeak/token"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestInterpreter_evaluate(t *testing.T) {
@@ -2744,6 +2746,37 @@ func TestInterpreter_Execute(t *testing.T) {
 	})
 }
 
+func TestInterpreter_ExecuteContext(t *testing.T) {
+	t.Run("stops an endless loop once the context is done", func(t *testing.T) {
+		program, err := ParseString(`
+		function spin() {
+			var i = 0;
+			while true {
+				i = i + 1;
+			}
+		}
+		spin();
+		`)
+		assert.Nil(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = NewInterpreter("", nil).ExecuteContext(ctx, program)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("does not execute anything with a cancelled context", func(t *testing.T) {
+		program, err := ParseString(`var x = 1;`)
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		in := NewInterpreter("", nil)
+		assert.ErrorIs(t, in.ExecuteContext(ctx, program), context.Canceled)
+		_, ok := in.Resolve("x", 0)
+		assert.False(t, ok)
+		assert.Nil(t, in.Execute(program))
+	})
+}
+
 func TestEnvironment_Resolve(t *testing.T) {
 	tests := []struct {
 		name  string
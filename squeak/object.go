@@ -25,18 +25,6 @@ type Instance interface {
 	Put(string, Object) Object
 }
 
-func NewRequestObject(req *http.Request) *ObjectInstance {
-	obj := &ObjectInstance{Properties: make(map[string]Object)}
-	obj.Properties["method"] = String{req.Method}
-	obj.Properties["url"] = String{req.URL.String()}
-	headers := &ObjectInstance{Properties: make(map[string]Object)}
-	for k, v := range req.Header {
-		headers.Put(k, String{strings.Join(v, ", ")})
-	}
-	obj.Properties["headers"] = headers
-	return obj
-}
-
 type BoundBuiltinMethod struct {
 	this Object
 	impl BuiltinMethod
@@ -88,11 +76,7 @@ func NewResponseObject(res *http.Response, body []byte) *ObjectInstance {
 	obj := &ObjectInstance{Properties: make(map[string]Object)}
 	obj.Properties["status_code"] = Number{float64(res.StatusCode)}
 	obj.Properties["status"] = String{res.Status}
-	headers := &ObjectInstance{Properties: make(map[string]Object)}
-	for k, v := range res.Header {
-		headers.Put(k, String{strings.Join(v, ", ")})
-	}
-	obj.Properties["headers"] = headers
+	obj.Properties["headers"] = headerObject(res.Header)
 
 	obj.Properties["json"] = BuiltinMethod{
 		arity: 0,
@@ -213,6 +197,10 @@ func (b *Builder) Object() Object {
 
 func (b *Builder) asObject(raw any) (Object, error) {
 	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return Boolean{v}, nil
 	case string:
 		return String{v}, nil
 	case int:
@@ -229,11 +217,66 @@ func (b *Builder) asObject(raw any) (Object, error) {
 			props[k] = prop
 		}
 		return &ObjectInstance{props}, nil
+	case []any:
+		items := make([]Object, len(v))
+		for i := range v {
+			item, err := b.asObject(v[i])
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return &List{slice: items}, nil
 	default:
 		return nil, fmt.Errorf("cannot convert %T to object", v)
 	}
 }
 
+// MarshalJSON encodes obj as JSON, which a [squeak.Builder] decodes back into an equal Object. Only nil, strings,
+// numbers, booleans and objects or lists holding such values can be encoded.
+func MarshalJSON(obj Object) ([]byte, error) {
+	v, err := jsonValue(obj)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func jsonValue(obj Object) (any, error) {
+	switch obj := obj.(type) {
+	case nil:
+		return nil, nil
+	case String:
+		return obj.value, nil
+	case Number:
+		return obj.value, nil
+	case Boolean:
+		return obj.value, nil
+	case *ObjectInstance:
+		props := make(map[string]any, len(obj.Properties))
+		for k, v := range obj.Properties {
+			prop, err := jsonValue(v)
+			if err != nil {
+				return nil, err
+			}
+			props[k] = prop
+		}
+		return props, nil
+	case *List:
+		items := make([]any, len(obj.slice))
+		for i, v := range obj.slice {
+			item, err := jsonValue(v)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("%w: %s cannot be encoded as JSON", ErrIllegalArgument, stringOf(obj))
+	}
+}
+
 // ObjectInstance is an asObject instance, which consists of a collection of named data as well as behaviours coupled to the
 // data.
 type ObjectInstance struct {
@@ -244,7 +287,7 @@ func (i *ObjectInstance) String() string {
 	sb := strings.Builder{}
 	sb.WriteString("Object {")
 	for k, v := range i.Properties {
-		sb.WriteString(fmt.Sprintf("%s: %s", k, v.String()))
+		sb.WriteString(fmt.Sprintf("%s: %s", k, stringOf(v)))
 	}
 	sb.WriteString("}")
 	return sb.String()
@@ -253,7 +296,7 @@ func (i *ObjectInstance) String() string {
 func (i *ObjectInstance) Clone() Object {
 	props := make(map[string]Object)
 	for k, v := range i.Properties {
-		props[k] = v.Clone()
+		props[k] = cloneOf(v)
 	}
 	return &ObjectInstance{Properties: props}
 }
@@ -267,6 +310,22 @@ func (i *ObjectInstance) Put(s string, object Object) Object {
 	return object
 }
 
+// stringOf returns the string representation of obj, which is "nil" for the nil Object.
+func stringOf(obj Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return obj.String()
+}
+
+// cloneOf returns a clone of obj, which is nil for the nil Object.
+func cloneOf(obj Object) Object {
+	if obj == nil {
+		return nil
+	}
+	return obj.Clone()
+}
+
 type Callable interface {
 	Object
 	Arity() int
@@ -384,6 +443,11 @@ func (i Number) Clone() Object {
 	}
 }
 
+// NewString returns a String holding the provided value.
+func NewString(v string) String {
+	return String{value: v}
+}
+
 // String is an Object representing a textual value.
 type String struct {
 	value string
@@ -472,7 +536,7 @@ type List struct {
 func (l *List) String() string {
 	items := make([]string, len(l.slice))
 	for i := range l.slice {
-		items[i] = l.slice[i].String()
+		items[i] = stringOf(l.slice[i])
 	}
 	return fmt.Sprintf("[%s]", strings.Join(items, ","))
 }
@@ -480,7 +544,7 @@ func (l *List) String() string {
 func (l *List) Clone() Object {
 	clone := make([]Object, len(l.slice))
 	for i, v := range l.slice {
-		clone[i] = v.Clone()
+		clone[i] = cloneOf(v)
 	}
 	return &List{slice: clone}
 }
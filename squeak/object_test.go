@@ -1,8 +1,10 @@
 package squeak
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
 )
 
@@ -77,3 +79,41 @@ func TestBuilder_UnmarshalXML(t *testing.T) {
 		},
 	}, builder.Object())
 }
+
+func TestBuilder_UnmarshalJSON(t *testing.T) {
+	builder := Builder{}
+	err := json.Unmarshal([]byte(`{"errors":[{"message":"not found","retry":false}],"data":null}`), &builder)
+	assert.Nil(t, err)
+	assert.Equal(t, &ObjectInstance{
+		Properties: map[string]Object{
+			"errors": &List{
+				slice: []Object{
+					&ObjectInstance{
+						Properties: map[string]Object{
+							"message": String{"not found"},
+							"retry":   Boolean{false},
+						},
+					},
+				},
+			},
+			"data": nil,
+		},
+	}, builder.Object())
+}
+
+func TestNewResponseObject_headers(t *testing.T) {
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+			"Set-Cookie":   []string{"a=1", "b=2"},
+		},
+	}
+	assert.Equal(t, &ObjectInstance{
+		Properties: map[string]Object{
+			"Content-Type": String{"application/json"},
+			"Set-Cookie":   &List{slice: []Object{String{"a=1"}, String{"b=2"}}},
+		},
+	}, NewResponseObject(res, nil).Get("headers"))
+}
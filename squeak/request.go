@@ -0,0 +1,285 @@
+package squeak
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequestObject exposes an [http.Request] to a script. Unlike the other objects, it is a view of the request rather
+// than a copy of it, assigning the method, url, query, headers or body of the object changes the request itself. The
+// body is only read from the request once the script asks for it. Values which cannot be written to the request, such
+// as a url which cannot be parsed, are reported by [squeak.RequestObject.Err] once the script has been executed.
+//
+// Query parameters and headers with a single value are exposed as a String, those with several values as a List of
+// String. Either may be assigned to set them, while assigning nil removes them.
+type RequestObject struct {
+	req *http.Request
+	// props holds any other property assigned to the object by the script.
+	props map[string]Object
+	err   error
+}
+
+func NewRequestObject(req *http.Request) *RequestObject {
+	return &RequestObject{req: req, props: make(map[string]Object)}
+}
+
+// Err returns the first error encountered while writing an assigned value to the request, if any.
+func (r *RequestObject) Err() error {
+	return r.err
+}
+
+func (r *RequestObject) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *RequestObject) String() string {
+	return fmt.Sprintf("Request {%s %s}", r.req.Method, r.req.URL)
+}
+
+// Clone returns a copy of the method, url, query and headers of the request which is detached from the request.
+func (r *RequestObject) Clone() Object {
+	return &ObjectInstance{
+		Properties: map[string]Object{
+			"method":  String{r.req.Method},
+			"url":     String{r.req.URL.String()},
+			"query":   r.Get("query").Clone(),
+			"headers": headerObject(r.req.Header),
+		},
+	}
+}
+
+func (r *RequestObject) Get(name string) Object {
+	switch name {
+	case "method":
+		return String{r.req.Method}
+	case "url":
+		return String{r.req.URL.String()}
+	case "query":
+		return &queryObject{request: r}
+	case "headers":
+		return &headersObject{request: r}
+	case "body":
+		body, err := r.body()
+		if err != nil {
+			r.fail(err)
+			return nil
+		}
+		return String{body}
+	default:
+		return r.props[name]
+	}
+}
+
+func (r *RequestObject) Put(name string, obj Object) Object {
+	switch name {
+	case "method", "url":
+		s, ok := obj.(String)
+		if !ok {
+			r.fail(fmt.Errorf("%w: request.%s must be a string", ErrIllegalArgument, name))
+			return obj
+		}
+		if name == "method" {
+			r.req.Method = s.value
+			return obj
+		}
+		u, err := url.Parse(s.value)
+		if err != nil {
+			r.fail(fmt.Errorf("%w: request.url: %v", ErrIllegalArgument, err))
+			return obj
+		}
+		r.req.URL = u
+		r.req.Host = u.Host
+	case "body":
+		switch body := obj.(type) {
+		case nil:
+			r.setBody(nil)
+		case String:
+			r.setBody([]byte(body.value))
+		default:
+			r.fail(fmt.Errorf("%w: request.body must be a string", ErrIllegalArgument))
+		}
+	case "query", "headers":
+		r.fail(fmt.Errorf("%w: request.%s cannot be replaced, assign its properties instead", ErrIllegalOperation, name))
+	default:
+		r.props[name] = obj
+	}
+	return obj
+}
+
+// body reads the body of the request, which is then replaced by a buffer holding what was read so that the request
+// can still be sent.
+func (r *RequestObject) body() (string, error) {
+	if r.req.Body == nil || r.req.Body == http.NoBody {
+		return "", nil
+	}
+	body, err := io.ReadAll(r.req.Body)
+	if err != nil {
+		return "", err
+	}
+	if err := r.req.Body.Close(); err != nil {
+		return "", err
+	}
+	r.setBody(body)
+	return string(body), nil
+}
+
+func (r *RequestObject) setBody(body []byte) {
+	r.req.ContentLength = int64(len(body))
+	if len(body) == 0 {
+		r.req.Body = http.NoBody
+		r.req.GetBody = func() (io.ReadCloser, error) {
+			return http.NoBody, nil
+		}
+		return
+	}
+	r.req.Body = io.NopCloser(bytes.NewReader(body))
+	r.req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// queryObject is a view of the query parameters of the request of a [squeak.RequestObject]. The order of the query
+// parameters is kept when they are assigned, a parameter which is assigned anew is moved to the end of the query.
+type queryObject struct {
+	request *RequestObject
+}
+
+func (q *queryObject) params() []string {
+	if q.request.req.URL.RawQuery == "" {
+		return nil
+	}
+	return strings.Split(q.request.req.URL.RawQuery, "&")
+}
+
+func (q *queryObject) String() string {
+	return q.Clone().String()
+}
+
+func (q *queryObject) Clone() Object {
+	query := q.request.req.URL.Query()
+	props := make(map[string]Object, len(query))
+	for k, v := range query {
+		props[k] = valuesObject(v)
+	}
+	return &ObjectInstance{Properties: props}
+}
+
+func (q *queryObject) Get(name string) Object {
+	var values []string
+	for _, param := range q.params() {
+		k, v, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(k); err != nil || key != name {
+			continue
+		}
+		value, err := url.QueryUnescape(v)
+		if err != nil {
+			value = v
+		}
+		values = append(values, value)
+	}
+	return valuesObject(values)
+}
+
+func (q *queryObject) Put(name string, obj Object) Object {
+	values, err := stringsOf(obj)
+	if err != nil {
+		q.request.fail(fmt.Errorf("request.query.%s: %w", name, err))
+		return obj
+	}
+	var params []string
+	for _, param := range q.params() {
+		k, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(k); err == nil && key == name {
+			continue
+		}
+		params = append(params, param)
+	}
+	for _, v := range values {
+		params = append(params, url.QueryEscape(name)+"="+url.QueryEscape(v))
+	}
+	q.request.req.URL.RawQuery = strings.Join(params, "&")
+	return obj
+}
+
+// headersObject is a view of the headers of the request of a [squeak.RequestObject]. Header names are case-insensitive.
+type headersObject struct {
+	request *RequestObject
+}
+
+func (h *headersObject) String() string {
+	return h.Clone().String()
+}
+
+func (h *headersObject) Clone() Object {
+	return headerObject(h.request.req.Header)
+}
+
+func (h *headersObject) Get(name string) Object {
+	return valuesObject(h.request.req.Header.Values(name))
+}
+
+func (h *headersObject) Put(name string, obj Object) Object {
+	values, err := stringsOf(obj)
+	if err != nil {
+		h.request.fail(fmt.Errorf("request.headers.%s: %w", name, err))
+		return obj
+	}
+	h.request.req.Header.Del(name)
+	for _, v := range values {
+		h.request.req.Header.Add(name, v)
+	}
+	return obj
+}
+
+// headerObject returns a detached object holding the values of the headers, each of which is given by valuesObject.
+func headerObject(header http.Header) *ObjectInstance {
+	obj := &ObjectInstance{Properties: make(map[string]Object)}
+	for k, v := range header {
+		obj.Put(k, valuesObject(v))
+	}
+	return obj
+}
+
+// valuesObject returns nil if there are no values, a String if there is one value and a List of String in the order in
+// which they were given otherwise.
+func valuesObject(values []string) Object {
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return String{values[0]}
+	}
+	items := make([]Object, len(values))
+	for i := range values {
+		items[i] = String{values[i]}
+	}
+	return &List{slice: items}
+}
+
+// stringsOf returns the values held by obj, which is either a String, a List of String or nil.
+func stringsOf(obj Object) ([]string, error) {
+	switch obj := obj.(type) {
+	case nil:
+		return nil, nil
+	case String:
+		return []string{obj.value}, nil
+	case *List:
+		values := make([]string, len(obj.slice))
+		for i, item := range obj.slice {
+			s, ok := item.(String)
+			if !ok {
+				return nil, fmt.Errorf("%w: expected a list of strings", ErrIllegalArgument)
+			}
+			values[i] = s.value
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%w: expected a string or a list of strings", ErrIllegalArgument)
+	}
+}
@@ -0,0 +1,94 @@
+package squeak
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestObject(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/users?b=2&a=1&b=3", strings.NewReader(`{"name": "pia"}`))
+	assert.Nil(t, err)
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Accept", "text/plain")
+	req.Header.Set("X-Remove", "yes")
+
+	var out bytes.Buffer
+	in := NewInterpreter("", &out)
+	request := NewRequestObject(req)
+	in.Declare("request", request)
+	ast, err := Parse(strings.NewReader(`
+		print(request.method + " " + request.query.b[1] + " " + request.headers.accept[0] + " " + request.body);
+		request.method = "PUT";
+		request.query.a = nil;
+		request.query.b = ["4", "5 6"];
+		request.query.c = "7";
+		request.headers.Authorization = "Signed " + request.body;
+		request.headers.Accept = "text/plain";
+		request.headers."X-Remove" = nil;
+		request.body = request.body + "!";
+		request.note = "kept";
+		print(" " + request.note);
+	`))
+	assert.Nil(t, err)
+	assert.Nil(t, in.Execute(ast))
+	assert.Nil(t, request.Err())
+	assert.Equal(t, `POST 3 application/json {"name": "pia"} kept`, out.String())
+
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.Equal(t, "https://example.com/users?b=4&b=5+6&c=7", req.URL.String())
+	assert.Equal(t, http.Header{
+		"Accept":        []string{"text/plain"},
+		"Authorization": []string{`Signed {"name": "pia"}`},
+	}, req.Header)
+	body, err := io.ReadAll(req.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name": "pia"}!`, string(body))
+	assert.Equal(t, int64(len(body)), req.ContentLength)
+	replay, err := req.GetBody()
+	assert.Nil(t, err)
+	body, err = io.ReadAll(replay)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name": "pia"}!`, string(body))
+}
+
+func TestRequestObject_url(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/users", nil)
+	assert.Nil(t, err)
+	in := NewInterpreter("", io.Discard)
+	request := NewRequestObject(req)
+	in.Declare("request", request)
+	ast, err := Parse(strings.NewReader(`request.url = "http://localhost:8080/v2/users?page=1";`))
+	assert.Nil(t, err)
+	assert.Nil(t, in.Execute(ast))
+	assert.Nil(t, request.Err())
+	assert.Equal(t, "localhost:8080", req.Host)
+	assert.Equal(t, "/v2/users", req.URL.Path)
+	assert.Equal(t, "page=1", req.URL.RawQuery)
+}
+
+func TestRequestObject_invalid(t *testing.T) {
+	for _, src := range []string{
+		`request.url = "http://[::1";`,
+		`request.method = 1;`,
+		`request.headers.Accept = 1;`,
+		`request.query.page = [1];`,
+		`request.headers = "Accept";`,
+		`request.body = 1;`,
+	} {
+		req, err := http.NewRequest(http.MethodGet, "https://example.com/users", nil)
+		assert.Nil(t, err)
+		in := NewInterpreter("", io.Discard)
+		request := NewRequestObject(req)
+		in.Declare("request", request)
+		ast, err := Parse(strings.NewReader(src))
+		assert.Nil(t, err)
+		assert.Nil(t, in.Execute(ast))
+		assert.True(t, errors.Is(request.Err(), ErrRuntimeFault), src)
+		assert.Equal(t, "https://example.com/users", req.URL.String(), src)
+	}
+}
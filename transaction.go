@@ -2,6 +2,9 @@ package pia
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/crookdc/pia/squeak"
 	"gopkg.in/yaml.v3"
 	"io"
@@ -15,6 +18,9 @@ import (
 type input struct {
 	File   string `yaml:"file"`
 	Inline string `yaml:"inline"`
+	// Interpolate turns interpolation of File off when set to false. Inline content is interpolated along with the rest
+	// of the configuration and is not affected.
+	Interpolate *bool `yaml:"interpolate"`
 }
 
 func (in *input) reader(wd string) (io.Reader, error) {
@@ -31,67 +37,365 @@ func (in *input) reader(wd string) (io.Reader, error) {
 	return nil, nil
 }
 
+// interpolated returns a reader of the input in which the content of File is interpolated by ip as it is streamed
+// from the file, which is opened once the reader is first read and closed once it has been read to its end or is
+// closed. Every key is resolved while the file is streamed, and once the end of the file is reached a
+// [pia.InterpolationErrors] listing every key which could not be resolved is returned by the reader. The input is read
+// as is if ip is nil or if interpolation of the input has been turned off.
+func (in *input) interpolated(wd string, ip *interpolation) (io.Reader, error) {
+	if ip == nil || in.Inline != "" || in.File == "" || (in.Interpolate != nil && !*in.Interpolate) {
+		return in.reader(wd)
+	}
+	path := join(wd, in.File)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return &lazyFile{
+		path: path,
+		wrap: func(r io.Reader) io.Reader {
+			return ip.wrap(r, WithSource(path), WithCollect())
+		},
+	}, nil
+}
+
 type body struct {
-	input `yaml:",inline"`
-	Form  map[string]string `yaml:"form"`
+	input     `yaml:",inline"`
+	Form      map[string]string `yaml:"form"`
+	Multipart []part            `yaml:"multipart"`
+	// JSON is encoded to JSON as it is written, which allows the body to be written using native YAML.
+	JSON    yaml.Node `yaml:"json"`
+	GraphQL *graphql  `yaml:"graphql"`
 }
 
-func (b *body) reader(wd string) (io.Reader, error) {
-	if len(b.Form) == 0 {
-		return b.input.reader(wd)
+// reader returns a reader of the body along with its content type, which is empty if the content type is unknown. A
+// body read from a file is interpolated by ip unless it is nil.
+func (b *body) reader(wd string, ip *interpolation) (io.Reader, string, error) {
+	if len(b.Multipart) > 0 {
+		body, contentType, err := multipartReader(wd, b.Multipart)
+		if err != nil {
+			return nil, "", err
+		}
+		return body, contentType, nil
 	}
-	body := url.Values{}
-	for k, v := range b.Form {
-		body.Set(k, v)
+	if len(b.Form) > 0 {
+		body := url.Values{}
+		for k, v := range b.Form {
+			body.Set(k, v)
+		}
+		return strings.NewReader(body.Encode()), "application/x-www-form-urlencoded", nil
 	}
-	return strings.NewReader(body.Encode()), nil
+	if b.JSON.Kind != 0 {
+		body, err := marshalNode(&b.JSON)
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(body), "application/json", nil
+	}
+	if b.GraphQL != nil {
+		r, err := b.GraphQL.reader(wd)
+		return r, "application/json", err
+	}
+	r, err := b.input.interpolated(wd, ip)
+	return r, "", err
 }
 
 // transaction represents a Transaction value in its textual YAML state. This data structure serves as a simple midway
 // stop while parsing text data into a Transaction.
 type transaction struct {
 	URL struct {
-		Target string            `yaml:"target"`
-		Query  map[string]string `yaml:"query"`
+		Target string `yaml:"target"`
+		Query  Fields `yaml:"query"`
 	} `yaml:"url"`
-	Method  string            `yaml:"method"`
-	Headers map[string]string `yaml:"headers"`
-	Body    body              `yaml:"body"`
+	Method  string `yaml:"method"`
+	Headers Fields `yaml:"headers"`
+	Body    body   `yaml:"body"`
 	Hooks   struct {
 		Before input `yaml:"before"`
 		After  input `yaml:"after"`
 	} `yaml:"hooks"`
+	Client ClientConfig `yaml:"client"`
+	Auth   Auth         `yaml:"auth"`
+	// Interpolation turns interpolation on or off for each top-level section, sections which are not listed are
+	// interpolated.
+	Interpolation map[string]bool `yaml:"interpolation"`
+}
+
+// TransactionOpt configures how [pia.ReadTransaction] reads a transaction.
+type TransactionOpt func(*transactionOptions)
+
+type transactionOptions struct {
+	structured bool
+	client     ClientConfig
+	filters    Filters
+}
+
+// WithStructuredInterpolation makes [pia.ReadTransaction] parse the configuration before interpolating it, rather than
+// interpolating the raw text of the configuration. Every string value of the configuration is then interpolated on its
+// own, which ensures that substituted values cannot change the structure of the configuration regardless of whether
+// they contain colons, quotes or line breaks. Mapping keys are not interpolated.
+func WithStructuredInterpolation() TransactionOpt {
+	return func(opts *transactionOptions) {
+		opts.structured = true
+	}
+}
+
+// WithClientDefaults makes [pia.ReadTransaction] use the supplied [pia.ClientConfig] for every option which is not
+// set in the client section of the transaction configuration.
+func WithClientDefaults(cfg ClientConfig) TransactionOpt {
+	return func(opts *transactionOptions) {
+		opts.client = cfg
+	}
+}
+
+// WithInterpolationFilters makes [pia.ReadTransaction] register the supplied filters with every [pia.Interpolator] it
+// creates, in addition to the filters returned by [pia.DefaultFilters].
+func WithInterpolationFilters(filters Filters) TransactionOpt {
+	return func(opts *transactionOptions) {
+		opts.filters = filters
+	}
+}
+
+// ReadTransaction opens the transaction configuration file found at path, interpolates it using the supplied
+// [pia.KeyResolver] and builds a Transaction value from the result. The directory containing the file is used as the
+// working directory of the transaction, and resolvers implementing [pia.Relocatable] are relocated to it. If the
+// resolver implements [pia.Resetter] then it is reset before interpolating, which scopes any values memoized by the
+// resolver to the transaction. Bodies and hooks read from files are interpolated as well, unless interpolation of their
+// section has been turned off or they set interpolate to false. If any keys of the configuration cannot be resolved
+// then a [pia.InterpolationErrors] listing all of them is returned, keys of files are resolved as the files are read.
+func ReadTransaction(resolver KeyResolver, path string, opts ...TransactionOpt) (*Transaction, error) {
+	var options transactionOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if r, ok := resolver.(Resetter); ok {
+		r.Reset()
+	}
+	if r, ok := resolver.(Relocatable); ok {
+		resolver = r.Relocate(filepath.Dir(path))
+	}
+	src, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var tx *Transaction
+	ip := &interpolation{resolver: resolver, filters: options.filters}
+	if options.structured {
+		tx, err = readStructured(ip, path, src)
+	} else {
+		tx, err = readText(ip, path, src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tx.Client = options.client.Merge(tx.Client)
+	return tx, nil
+}
+
+// interpolation holds what is needed to interpolate a transaction configuration and the files it refers to.
+type interpolation struct {
+	resolver KeyResolver
+	filters  Filters
+}
+
+// wrap returns a [pia.Interpolator] of r using the resolver and filters of the interpolation.
+func (ip *interpolation) wrap(r io.Reader, opts ...InterpolatorOpt) *Interpolator {
+	return WrapReader(ip.resolver, r, append(opts, WithFilters(ip.filters))...)
+}
+
+// readText interpolates the configuration found in src in its entirety before building a Transaction value from it,
+// which allows every unresolvable key to be reported at once rather than having the parser stop at the first one.
+func readText(ip *interpolation, path string, src []byte) (*Transaction, error) {
+	src, err := io.ReadAll(ip.wrap(bytes.NewReader(escape(src)), WithSource(path), WithCollect()))
+	if err != nil {
+		return nil, err
+	}
+	return parseTransaction(filepath.Dir(path), bytes.NewReader(src), ip)
+}
+
+// readStructured parses the configuration found in src and interpolates each of its string values separately before
+// building a Transaction value from it.
+func readStructured(ip *interpolation, path string, src []byte) (*Transaction, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return parseTransaction(filepath.Dir(path), bytes.NewReader(src), ip)
+	}
+	root := doc.Content[0]
+	var opts struct {
+		Interpolation map[string]bool `yaml:"interpolation"`
+	}
+	if err := root.Decode(&opts); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var missing InterpolationErrors
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		section := root.Content[i].Value
+		if enabled, ok := opts.Interpolation[section]; section == "interpolation" || (ok && !enabled) {
+			continue
+		}
+		if err := interpolateNode(ip, path, root.Content[i+1], &missing); err != nil {
+			return nil, err
+		}
+	}
+	if len(missing) > 0 {
+		return nil, missing
+	}
+	var cfg transaction
+	if err := root.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return newTransaction(filepath.Dir(path), cfg, ip)
+}
+
+// interpolateNode interpolates every scalar value found within node in place. Substitution points which cannot be
+// resolved are appended to missing.
+func interpolateNode(ip *interpolation, path string, node *yaml.Node, missing *InterpolationErrors) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := interpolateNode(ip, path, node.Content[i], missing); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := interpolateNode(ip, path, item, missing); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "${") {
+			return nil
+		}
+		line, column := node.Line, node.Column
+		switch node.Style {
+		case yaml.LiteralStyle, yaml.FoldedStyle:
+			// The content of a block scalar starts on the line following its indicator. Its columns are counted from
+			// the indentation of the content.
+			line, column = line+1, 1
+		case yaml.SingleQuotedStyle, yaml.DoubleQuotedStyle:
+			column++
+		}
+		r := ip.wrap(strings.NewReader(node.Value), WithSource(path), WithPosition(line, column), WithCollect())
+		v, err := io.ReadAll(r)
+		var errs InterpolationErrors
+		if errors.As(err, &errs) {
+			*missing = append(*missing, errs...)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		node.Value = string(v)
+		if node.Style == 0 && node.Tag == "!!str" {
+			// The type of a plain scalar is resolved from its interpolated value, just as if the raw text had been
+			// interpolated, which makes "${count}" a number if count is.
+			node.Tag = ""
+		}
+	}
+	// Aliases are left alone since the node they refer to is interpolated where it is defined.
+	return nil
 }
 
-// ParseTransaction reads the provided transaction configuration and builds a Transaction value from it.
+// escape escapes every substitution point found within the top-level sections of the transaction configuration for
+// which interpolation has been turned off, such as the body in the following configuration.
+//
+//	interpolation:
+//	  body: false
+//
+// The configuration is returned as is if it cannot be parsed before being interpolated.
+func escape(src []byte) []byte {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil || len(doc.Content) == 0 {
+		return src
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode || root.Style&yaml.FlowStyle != 0 {
+		return src
+	}
+	var cfg struct {
+		Interpolation map[string]bool `yaml:"interpolation"`
+	}
+	if err := root.Decode(&cfg); err != nil || len(cfg.Interpolation) == 0 {
+		return src
+	}
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	for i := 0; i < len(root.Content); i += 2 {
+		if enabled, ok := cfg.Interpolation[root.Content[i].Value]; !ok || enabled {
+			continue
+		}
+		// A section of a block mapping spans from the line of its key up until the line of the next key.
+		start, end := root.Content[i].Line, len(lines)+1
+		if i+2 < len(root.Content) {
+			end = root.Content[i+2].Line
+		}
+		for j := start; j < end; j++ {
+			lines[j-1] = bytes.ReplaceAll(lines[j-1], []byte("${"), []byte("$${"))
+		}
+	}
+	return bytes.Join(lines, nil)
+}
+
+// ParseTransaction reads the provided transaction configuration and builds a Transaction value from it. The
+// configuration is not interpolated, and neither are the files it refers to.
 func ParseTransaction(wd string, r io.Reader) (*Transaction, error) {
+	return parseTransaction(wd, r, nil)
+}
+
+func parseTransaction(wd string, r io.Reader, ip *interpolation) (*Transaction, error) {
 	var cfg transaction
 	err := yaml.NewDecoder(r).Decode(&cfg)
 	if err != nil {
 		return nil, err
 	}
+	return newTransaction(wd, cfg, ip)
+}
+
+// newTransaction builds a Transaction value from its configuration. The body and hooks which are read from files are
+// interpolated by ip, unless it is nil or interpolation of their section has been turned off.
+func newTransaction(wd string, cfg transaction, ip *interpolation) (*Transaction, error) {
+	var err error
 	tx := Transaction{
 		WD: wd,
 		URL: struct {
 			Target string
-			Query  map[string]string
+			Query  Fields
 		}{
 			Target: cfg.URL.Target,
 			Query:  cfg.URL.Query,
 		},
 		Method:  cfg.Method,
 		Headers: cfg.Headers,
+		Client:  cfg.Client,
+		Auth:    cfg.Auth,
+	}
+	tx.graphql = cfg.Body.GraphQL != nil
+	if err := tx.Auth.validate(); err != nil {
+		return nil, err
 	}
 
-	tx.Body, err = cfg.Body.reader(wd)
+	section := func(name string) *interpolation {
+		if enabled, ok := cfg.Interpolation[name]; ok && !enabled {
+			return nil
+		}
+		return ip
+	}
+	tx.Body, tx.ContentType, err = cfg.Body.reader(wd, section("body"))
 	if err != nil {
 		return nil, err
 	}
-	tx.Hooks.Before, err = cfg.Hooks.Before.reader(wd)
+	tx.Hooks.Before, err = cfg.Hooks.Before.interpolated(wd, section("hooks"))
 	if err != nil {
 		return nil, err
 	}
-	tx.Hooks.After, err = cfg.Hooks.After.reader(wd)
+	tx.Hooks.After, err = cfg.Hooks.After.interpolated(wd, section("hooks"))
 	if err != nil {
 		return nil, err
 	}
@@ -102,52 +406,114 @@ type Transaction struct {
 	WD  string
 	URL struct {
 		Target string
-		Query  map[string]string
+		// Query is appended to the query of Target.
+		Query Fields
 	}
 	Method  string
-	Headers map[string]string
+	Headers Fields
 	Body    io.Reader
-	Hooks   struct {
+	// ContentType is the content type of Body, which is sent unless Headers sets a content type of its own.
+	ContentType string
+	Hooks       struct {
 		Before io.Reader
 		After  io.Reader
 	}
+	// Client configures the HTTP client used to execute the transaction, relative paths are resolved against WD.
+	Client ClientConfig
+	// Auth configures how the request is authenticated.
+	Auth Auth
+	// graphql is set if the body is a GraphQL request, in which case the errors of the response are exposed to the
+	// after hook.
+	graphql bool
 }
 
-func (tx *Transaction) Execute(in *squeak.Interpreter) (*http.Response, error) {
+// ExecuteOptions configures how [pia.Transaction.Execute] executes a transaction. The zero value is ready to use.
+type ExecuteOptions struct {
+	// Context controls the cancellation and deadline of the request, including the execution of its hooks which are
+	// stopped before their next statement once the context is done. If nil, [context.Background] is used.
+	Context context.Context
+	// Client sends the request. If nil, a client configured according to the Client section of the transaction is
+	// used.
+	Client *http.Client
+	// Clients provides the client configured according to the Client section of the transaction if Client is nil,
+	// which allows connections to be reused from one execution to the next. If nil, a client is built for the
+	// execution alone.
+	Clients *Clients
+	// Transport replaces the transport of the client sending the request if non-nil, which allows requests to be served
+	// without going through the network. The options of the Client section of the transaction which configure the
+	// transport, such as its proxy and TLS options, are then ignored.
+	Transport http.RoundTripper
+	// Interpreter executes the hooks of the transaction. If nil, an interpreter which discards all output is created.
+	Interpreter *squeak.Interpreter
+	// Session caches tokens obtained by the auth section of the transaction. If nil, tokens are obtained anew each time.
+	Session *Session
+}
+
+// Execute sends the request described by the transaction and runs its hooks. The before hook is run before sending the
+// request and may change its method, url, query, headers and body through the request object, while the after hook is
+// run once the response has been received.
+func (tx *Transaction) Execute(opts ExecuteOptions) (*http.Response, error) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client := opts.Client
+	if client == nil {
+		var err error
+		if opts.Clients != nil {
+			client, err = opts.Clients.Client(tx.Client, tx.WD)
+		} else {
+			client, err = tx.Client.Client(tx.WD)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.Transport != nil {
+		c := *client
+		c.Transport = opts.Transport
+		client = &c
+	}
+	in := opts.Interpreter
+	if in == nil {
+		in = squeak.NewInterpreter(tx.WD, io.Discard)
+	}
 	req, err := tx.Request()
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	if tx.Hooks.Before != nil {
-		if err := tx.before(in, req); err != nil {
+		if err := tx.before(ctx, in, req); err != nil {
 			return nil, err
 		}
 	}
-	res, err := http.DefaultClient.Do(req)
+	res, err := tx.Auth.send(client, req, opts.Session)
 	if err != nil {
 		return nil, err
 	}
 	if tx.Hooks.After != nil {
-		if err := tx.after(in, res); err != nil {
+		if err := tx.after(ctx, in, res); err != nil {
 			return nil, err
 		}
 	}
 	return res, nil
 }
 
-func (tx *Transaction) before(in *squeak.Interpreter, req *http.Request) error {
+func (tx *Transaction) before(ctx context.Context, in *squeak.Interpreter, req *http.Request) error {
 	ast, err := squeak.Parse(tx.Hooks.Before)
 	if err != nil {
 		return err
 	}
-	in.Declare("request", squeak.NewRequestObject(req))
-	if err := in.Execute(ast); err != nil {
+	request := squeak.NewRequestObject(req)
+	in.Declare("request", request)
+	if err := in.ExecuteContext(ctx, ast); err != nil {
 		return err
 	}
-	return nil
+	return request.Err()
 }
 
-func (tx *Transaction) after(in *squeak.Interpreter, res *http.Response) error {
+func (tx *Transaction) after(ctx context.Context, in *squeak.Interpreter, res *http.Response) error {
 	ast, err := squeak.Parse(tx.Hooks.After)
 	if err != nil {
 		return err
@@ -161,8 +527,12 @@ func (tx *Transaction) after(in *squeak.Interpreter, res *http.Response) error {
 		// Allow the response body to be re-read by assigning a new io.Reader to it.
 		res.Body = io.NopCloser(bytes.NewBuffer(body))
 	}
-	in.Declare("response", squeak.NewResponseObject(res, body))
-	if err := in.Execute(ast); err != nil {
+	response := squeak.NewResponseObject(res, body)
+	if tx.graphql {
+		response.Put("graphql_errors", graphqlErrors(body))
+	}
+	in.Declare("response", response)
+	if err := in.ExecuteContext(ctx, ast); err != nil {
 		return err
 	}
 	return nil
@@ -170,19 +540,32 @@ func (tx *Transaction) after(in *squeak.Interpreter, res *http.Response) error {
 
 // Request returns an [http.Request] which mirrors the configuration represented by the Transaction. The ownership of
 // the request value is given to the caller, this means that the Transaction struct will not keep any reference to the
-// produced request after returning and eventually closing the request is up to the caller.
+// produced request after returning and eventually closing the request is up to the caller. The request is not
+// authenticated since authentication is applied by [pia.Transaction.Execute] right before sending the request.
 func (tx *Transaction) Request() (*http.Request, error) {
 	req, err := http.NewRequest(tx.Method, tx.URL.Target, tx.Body)
 	if err != nil {
 		return nil, err
 	}
-	q := req.URL.Query()
-	for k, v := range tx.URL.Query {
-		q.Add(k, v)
+	if body, ok := tx.Body.(*multipartBody); ok {
+		// The length of the other bodies which are known up front is set by http.NewRequest.
+		req.ContentLength = body.size
+	}
+	if len(tx.URL.Query) > 0 {
+		if req.URL.RawQuery != "" {
+			req.URL.RawQuery += "&"
+		}
+		req.URL.RawQuery += tx.URL.Query.encode()
+	}
+	if tx.ContentType != "" {
+		req.Header.Set("Content-Type", tx.ContentType)
+	}
+	for _, h := range tx.Headers {
+		// Headers of the transaction replace any header set above rather than adding to it.
+		req.Header.Del(h.Name)
 	}
-	req.URL.RawQuery = q.Encode()
-	for k, v := range tx.Headers {
-		req.Header.Set(k, v)
+	for _, h := range tx.Headers {
+		req.Header.Add(h.Name, h.Value)
 	}
 	return req, nil
 }
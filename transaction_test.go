@@ -1,11 +1,15 @@
 package pia
 
 import (
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -32,7 +36,7 @@ func TestTransaction_Request(t *testing.T) {
 			tx: &Transaction{
 				URL: struct {
 					Target string
-					Query  map[string]string
+					Query  Fields
 				}{
 					Target: "https://google.com/",
 				},
@@ -53,12 +57,12 @@ func TestTransaction_Request(t *testing.T) {
 			tx: &Transaction{
 				URL: struct {
 					Target string
-					Query  map[string]string
+					Query  Fields
 				}{
 					Target: "https://google.com/",
-					Query: map[string]string{
-						"s": "hello darkness my old friend",
-						"p": "1",
+					Query: Fields{
+						{Name: "p", Value: "1"},
+						{Name: "s", Value: "hello darkness my old friend"},
 					},
 				},
 				Method: http.MethodGet,
@@ -78,17 +82,17 @@ func TestTransaction_Request(t *testing.T) {
 			tx: &Transaction{
 				URL: struct {
 					Target string
-					Query  map[string]string
+					Query  Fields
 				}{
 					Target: "https://secured.google.com/",
-					Query: map[string]string{
-						"key": "aeäö",
+					Query: Fields{
+						{Name: "key", Value: "aeäö"},
 					},
 				},
 				Method: http.MethodPost,
-				Headers: map[string]string{
-					"Authorization": "Bearer abc1234",
-					"Content-Type":  "application/json",
+				Headers: Fields{
+					{Name: "Authorization", Value: "Bearer abc1234"},
+					{Name: "Content-Type", Value: "application/json"},
 				},
 			},
 			req: struct {
@@ -109,13 +113,13 @@ func TestTransaction_Request(t *testing.T) {
 			tx: &Transaction{
 				URL: struct {
 					Target string
-					Query  map[string]string
+					Query  Fields
 				}{
 					Target: "https://secured.google.com/",
 				},
 				Method: http.MethodPost,
-				Headers: map[string]string{
-					"Content-Type": "application/json",
+				Headers: Fields{
+					{Name: "Content-Type", Value: "application/json"},
 				},
 				Body: strings.NewReader(`{"username": "admin", "password": "nimda"}`),
 			},
@@ -154,3 +158,321 @@ func TestTransaction_Request(t *testing.T) {
 		})
 	}
 }
+
+func TestReadTransaction_missingKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "login.yml")
+	err := os.WriteFile(path, []byte(`method: POST
+url:
+  target: ${props:host}/login
+headers:
+  Authorization: Bearer ${session:token}
+`), 0o644)
+	assert.Nil(t, err)
+	_, err = ReadTransaction(MapResolver{}, path)
+	var missing InterpolationErrors
+	assert.True(t, errors.As(err, &missing))
+	assert.Len(t, missing, 2)
+	assert.Equal(t, path, missing[0].Source)
+	assert.Equal(t, 3, missing[0].Line)
+	assert.Equal(t, 11, missing[0].Column)
+	assert.Equal(t, 5, missing[1].Line)
+	assert.Equal(t, 25, missing[1].Column)
+}
+
+func TestReadTransaction_interpolationOptOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.yml")
+	err := os.WriteFile(path, []byte(`method: POST
+interpolation:
+  body: false
+url:
+  target: ${props:host}/scripts
+body:
+  inline: |
+    #!/bin/sh
+    echo "${HOME}" "$${PWD}"
+headers:
+  X-Home: $${HOME}
+`), 0o644)
+	assert.Nil(t, err)
+	tx, err := ReadTransaction(MapResolver{"props:host": "https://example.com"}, path)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/scripts", tx.URL.Target)
+	assert.Equal(t, "${HOME}", tx.Headers.Get("X-Home"))
+	body, err := io.ReadAll(tx.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "#!/bin/sh\necho \"${HOME}\" \"$${PWD}\"\n", string(body))
+}
+
+func TestReadTransaction_structuredInterpolation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.yml")
+	err := os.WriteFile(path, []byte(`method: ${props:method}
+url:
+  target: "${props:host}/users"
+  query:
+    name: ${props:name}
+headers:
+  X-Injected: ${props:header}
+body:
+  inline: |
+    {"name": "${props:name}"}
+hooks:
+  after:
+    inline: |
+      println("${props:name}");
+`), 0o644)
+	assert.Nil(t, err)
+	resolver := MapResolver{
+		"props:method": "POST",
+		"props:host":   "https://example.com",
+		"props:name":   "pia: \"the\nalternative\"",
+		"props:header": "abc\nmethod: DELETE",
+	}
+	tx, err := ReadTransaction(resolver, path, WithStructuredInterpolation())
+	assert.Nil(t, err)
+	assert.Equal(t, "POST", tx.Method)
+	assert.Equal(t, "https://example.com/users", tx.URL.Target)
+	assert.Equal(t, Fields{{Name: "name", Value: "pia: \"the\nalternative\""}}, tx.URL.Query)
+	assert.Equal(t, Fields{{Name: "X-Injected", Value: "abc\nmethod: DELETE"}}, tx.Headers)
+	body, err := io.ReadAll(tx.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"name\": \"pia: \"the\nalternative\"\"}\n", string(body))
+	after, err := io.ReadAll(tx.Hooks.After)
+	assert.Nil(t, err)
+	assert.Equal(t, "println(\"pia: \"the\nalternative\"\");\n", string(after))
+
+	_, err = ReadTransaction(MapResolver{}, path, WithStructuredInterpolation())
+	var missing InterpolationErrors
+	assert.True(t, errors.As(err, &missing))
+	positions := make([][2]int, len(missing))
+	for i, m := range missing {
+		positions[i] = [2]int{m.Line, m.Column}
+	}
+	assert.Equal(t, [][2]int{{1, 9}, {3, 12}, {5, 11}, {7, 15}, {10, 11}, {14, 10}}, positions)
+}
+
+func TestReadTransaction_structuredInterpolationOptOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.yml")
+	err := os.WriteFile(path, []byte(`method: POST
+interpolation:
+  body: false
+url:
+  target: ${props:host}/scripts
+body:
+  inline: echo "${HOME}"
+`), 0o644)
+	assert.Nil(t, err)
+	tx, err := ReadTransaction(MapResolver{"props:host": "https://example.com"}, path, WithStructuredInterpolation())
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/scripts", tx.URL.Target)
+	body, err := io.ReadAll(tx.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `echo "${HOME}"`, string(body))
+}
+
+func TestReadTransaction_files(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"name": "${props:name}", "raw": "$${props:name}"}`), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "before.sqk"), []byte(`println("${props:name}");`), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "after.sqk"), []byte(`println("${props:name}");`), 0o644))
+	path := filepath.Join(dir, "users.yml")
+	assert.Nil(t, os.WriteFile(path, []byte(`method: POST
+url:
+  target: ${props:host}/users
+body:
+  file: user.json
+hooks:
+  before:
+    file: before.sqk
+  after:
+    file: after.sqk
+    interpolate: false
+`), 0o644))
+	resolver := MapResolver{"props:host": "https://example.com", "props:name": "pia"}
+	for _, opts := range [][]TransactionOpt{nil, {WithStructuredInterpolation()}} {
+		tx, err := ReadTransaction(resolver, path, opts...)
+		assert.Nil(t, err)
+		// The interpolated file is streamed, which leaves closing it to whoever reads the body.
+		assert.Implements(t, (*io.ReadCloser)(nil), tx.Body)
+		body, err := io.ReadAll(tx.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, `{"name": "pia", "raw": "${props:name}"}`, string(body))
+		before, err := io.ReadAll(tx.Hooks.Before)
+		assert.Nil(t, err)
+		assert.Equal(t, `println("pia");`, string(before))
+		after, err := io.ReadAll(tx.Hooks.After)
+		assert.Nil(t, err)
+		assert.Equal(t, `println("${props:name}");`, string(after))
+
+		// Keys of files are resolved as the files are streamed, which is when missing keys are reported.
+		tx, err = ReadTransaction(MapResolver{"props:host": "https://example.com"}, path, opts...)
+		assert.Nil(t, err)
+		body, err = io.ReadAll(tx.Body)
+		assert.Equal(t, `{"name": "${props:name}", "raw": "${props:name}"}`, string(body))
+		var missing InterpolationErrors
+		assert.True(t, errors.As(err, &missing))
+		assert.Len(t, missing, 1)
+		assert.Equal(t, filepath.Join(dir, "user.json"), missing[0].Source)
+		assert.Equal(t, 1, missing[0].Line)
+		assert.Equal(t, 11, missing[0].Column)
+	}
+
+	tx, err := ParseTransaction(dir, strings.NewReader("body:\n  file: user.json"))
+	assert.Nil(t, err)
+	body, err := io.ReadAll(tx.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name": "${props:name}", "raw": "$${props:name}"}`, string(body))
+}
+
+// countingResolver counts how many times each key is resolved.
+type countingResolver map[string]int
+
+func (c countingResolver) Resolve(k string) (string, error) {
+	c[k]++
+	return k, nil
+}
+
+func TestReadTransaction_filesResolvedOnce(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"name": "${name}"}`), 0o644))
+	path := filepath.Join(dir, "users.yml")
+	assert.Nil(t, os.WriteFile(path, []byte("method: POST\nbody:\n  file: user.json\n"), 0o644))
+	resolver := countingResolver{}
+	tx, err := ReadTransaction(resolver, path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, resolver["name"])
+	body, err := io.ReadAll(tx.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name": "name"}`, string(body))
+	assert.Equal(t, 1, resolver["name"])
+}
+
+func TestReadTransaction_filesOptOut(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "script.sh"), []byte(`echo "${HOME}"`), 0o644))
+	path := filepath.Join(dir, "script.yml")
+	assert.Nil(t, os.WriteFile(path, []byte(`method: POST
+interpolation:
+  body: false
+body:
+  file: script.sh
+`), 0o644))
+	tx, err := ReadTransaction(MapResolver{}, path)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(tx.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `echo "${HOME}"`, string(body))
+}
+
+func TestParseTransaction_fields(t *testing.T) {
+	tx, err := ParseTransaction("", strings.NewReader(`method: GET
+url:
+  target: https://example.com/users?sort=name
+  query:
+    id:
+      - 2
+      - 1
+    fields: name
+    empty:
+headers:
+  Accept:
+    - application/json
+    - text/plain
+  X-Request-Id: abc
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, Fields{
+		{Name: "id", Value: "2"},
+		{Name: "id", Value: "1"},
+		{Name: "fields", Value: "name"},
+		{Name: "empty", Value: ""},
+	}, tx.URL.Query)
+	assert.Equal(t, []string{"application/json", "text/plain"}, tx.Headers.Values("Accept"))
+	assert.Equal(t, "abc", tx.Headers.Get("X-Request-Id"))
+	req, err := tx.Request()
+	assert.Nil(t, err)
+	assert.Equal(t, "sort=name&id=2&id=1&fields=name&empty=", req.URL.RawQuery)
+	assert.Equal(t, []string{"application/json", "text/plain"}, req.Header.Values("Accept"))
+
+	_, err = ParseTransaction("", strings.NewReader("headers:\n  Accept:\n    nested: value"))
+	assert.NotNil(t, err)
+}
+
+func TestTransaction_Execute_before(t *testing.T) {
+	var method, query, signature, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, query, signature = r.Method, r.URL.RawQuery, r.Header.Get("X-Signature")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+	tx, err := ParseTransaction("", strings.NewReader(fmt.Sprintf(`
+method: POST
+url:
+  target: %s/users
+  query:
+    page: 1
+body:
+  inline: '{"name": "pia"}'
+hooks:
+  before:
+    inline: |
+      request.method = "PUT";
+      request.query.page = "2";
+      request.headers."X-Signature" = request.method + " " + request.body;
+      request.body = "{}";
+`, server.URL)))
+	assert.Nil(t, err)
+	_, err = tx.Execute(ExecuteOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "page=2", query)
+	assert.Equal(t, `PUT {"name": "pia"}`, signature)
+	assert.Equal(t, "{}", body)
+
+	tx, err = ParseTransaction("", strings.NewReader(fmt.Sprintf(`
+url:
+  target: %s/users
+hooks:
+  before:
+    inline: request.url = "http://[::1";
+`, server.URL)))
+	assert.Nil(t, err)
+	_, err = tx.Execute(ExecuteOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestReadTransaction_filters(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "user.txt"), []byte(`${props:name | shout}`), 0o644))
+	path := filepath.Join(dir, "users.yml")
+	assert.Nil(t, os.WriteFile(path, []byte(`method: POST
+url:
+  target: https://example.com/${props:name | shout}
+body:
+  file: user.txt
+`), 0o644))
+	filters := Filters{
+		"shout": func(s string) (string, error) {
+			return strings.ToUpper(s) + "!", nil
+		},
+	}
+	resolver := MapResolver{"props:name": "pia"}
+	for _, opts := range [][]TransactionOpt{
+		{WithInterpolationFilters(filters)},
+		{WithInterpolationFilters(filters), WithStructuredInterpolation()},
+	} {
+		tx, err := ReadTransaction(resolver, path, opts...)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://example.com/PIA!", tx.URL.Target)
+		body, err := io.ReadAll(tx.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "PIA!", string(body))
+	}
+	// Without the filter, its name is a fallback key which is never needed since the first key can be resolved.
+	tx, err := ReadTransaction(resolver, path)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/pia", tx.URL.Target)
+	_, err = ReadTransaction(MapResolver{}, path)
+	assert.ErrorIs(t, err, ErrUnknownFilter)
+}
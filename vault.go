@@ -0,0 +1,190 @@
+package pia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrVaultNotFound = errors.New("vault not found")
+	ErrVaultExists   = errors.New("vault already exists")
+)
+
+type vaultFile struct {
+	Salt   []byte `json:"salt"`
+	Sealed []byte `json:"sealed"`
+}
+
+// InitVault creates a new empty [pia.Vault] at path which is encrypted using the passphrase. An error wrapping
+// [pia.ErrVaultExists] is returned if there already is a file at path.
+func InitVault(path, passphrase string) (*Vault, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrVaultExists, path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	v := &Vault{path: path, passphrase: passphrase, entries: make(map[string]string)}
+	if err := v.Save(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// OpenVault decrypts the [pia.Vault] found at path using the passphrase. An error wrapping [pia.ErrVaultNotFound] is
+// returned if there is no vault at path and an error wrapping [pia.ErrSealed] is returned if the passphrase is
+// incorrect.
+func OpenVault(path, passphrase string) (*Vault, error) {
+	src, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrVaultNotFound, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file vaultFile
+	if err := json.Unmarshal(src, &file); err != nil {
+		return nil, fmt.Errorf("invalid vault file %s: %w", path, err)
+	}
+	slr, err := newSealer(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := slr.open(file.Sealed)
+	if err != nil {
+		return nil, fmt.Errorf("vault %s: %w", path, err)
+	}
+	entries := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return nil, fmt.Errorf("invalid vault file %s: %w", path, err)
+	}
+	return &Vault{path: path, passphrase: passphrase, entries: entries}, nil
+}
+
+// Vault is a store of secrets kept in a single file which is encrypted using a passphrase. Both the keys and the values
+// of the entries are encrypted, which makes the file safe to commit alongside the transactions using it. The entries
+// are held decrypted in memory once the vault has been opened, and changes are only written to disk by
+// [pia.Vault.Save].
+//
+// Every value of the vault is considered secret, see [pia.SecretKeeper].
+type Vault struct {
+	mu         sync.RWMutex
+	path       string
+	passphrase string
+	entries    map[string]string
+}
+
+// Resolve implements the [pia.KeyResolver] interface.
+func (v *Vault) Resolve(k string) (string, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	value, ok := v.entries[k]
+	if !ok {
+		return "", fmt.Errorf("%w: %s is not in vault", ErrKeyNotFound, k)
+	}
+	return value, nil
+}
+
+// Secrets implements the [pia.SecretKeeper] interface.
+func (v *Vault) Secrets() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return slices.Collect(maps.Values(v.entries))
+}
+
+// Set stores the value under the key, replacing any previous value.
+func (v *Vault) Set(k, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.entries[k] = value
+}
+
+// Delete removes the key from the vault.
+func (v *Vault) Delete(k string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.entries, k)
+}
+
+// Keys returns the keys stored in the vault in lexical order.
+func (v *Vault) Keys() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return slices.Sorted(maps.Keys(v.entries))
+}
+
+// Rotate re-encrypts the vault using a new passphrase and writes it to disk.
+func (v *Vault) Rotate(passphrase string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	previous := v.passphrase
+	v.passphrase = passphrase
+	if err := v.save(); err != nil {
+		v.passphrase = previous
+		return err
+	}
+	return nil
+}
+
+// Save encrypts the entries of the vault and writes them to disk. A new salt is used with each save.
+func (v *Vault) Save() error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.save()
+}
+
+func (v *Vault) save() error {
+	plaintext, err := json.Marshal(v.entries)
+	if err != nil {
+		return err
+	}
+	slr, err := newSealer(v.passphrase, nil)
+	if err != nil {
+		return err
+	}
+	sealed, err := slr.seal(plaintext)
+	if err != nil {
+		return err
+	}
+	src, err := json.MarshalIndent(vaultFile{Salt: slr.salt, Sealed: sealed}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(v.path, src)
+}
+
+// SecretKeeper is implemented by a [pia.KeyResolver] holding values which should never be displayed.
+type SecretKeeper interface {
+	// Secrets returns every secret value held by the resolver.
+	Secrets() []string
+}
+
+// Redact replaces every occurrence of the secret values held by the resolver within text with asterisks. Resolvers
+// which do not implement [pia.SecretKeeper] hold no secrets.
+func Redact(resolver KeyResolver, text string) string {
+	keeper, ok := resolver.(SecretKeeper)
+	if !ok {
+		return text
+	}
+	secrets := slices.DeleteFunc(keeper.Secrets(), func(s string) bool {
+		return s == ""
+	})
+	if len(secrets) == 0 {
+		return text
+	}
+	// Longer secrets are replaced first since a shorter secret could be contained within a longer one.
+	slices.SortFunc(secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, s := range secrets {
+		pairs = append(pairs, s, "********")
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
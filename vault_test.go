@@ -0,0 +1,84 @@
+package pia_test
+
+import (
+	"github.com/crookdc/pia"
+	"github.com/crookdc/pia/squeak"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".pia", "vault.json")
+	_, err := pia.OpenVault(path, "hunter2")
+	assert.ErrorIs(t, err, pia.ErrVaultNotFound)
+
+	vault, err := pia.InitVault(path, "hunter2")
+	assert.Nil(t, err)
+	_, err = pia.InitVault(path, "hunter2")
+	assert.ErrorIs(t, err, pia.ErrVaultExists)
+
+	vault.Set("api_key", "s3cr3t-k3y")
+	vault.Set("password", "P@$$W0RD")
+	vault.Set("removed", "value")
+	vault.Delete("removed")
+	assert.Nil(t, vault.Save())
+
+	src, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(src), "api_key")
+	assert.NotContains(t, string(src), "s3cr3t-k3y")
+
+	_, err = pia.OpenVault(path, "wrong")
+	assert.ErrorIs(t, err, pia.ErrSealed)
+	vault, err = pia.OpenVault(path, "hunter2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"api_key", "password"}, vault.Keys())
+	value, err := vault.Resolve("api_key")
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t-k3y", value)
+	_, err = vault.Resolve("removed")
+	assert.ErrorIs(t, err, pia.ErrKeyNotFound)
+
+	assert.Nil(t, vault.Rotate("correct horse"))
+	_, err = pia.OpenVault(path, "hunter2")
+	assert.ErrorIs(t, err, pia.ErrSealed)
+	vault, err = pia.OpenVault(path, "correct horse")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"api_key", "password"}, vault.Keys())
+}
+
+func TestRedact(t *testing.T) {
+	vault, err := pia.InitVault(filepath.Join(t.TempDir(), "vault.json"), "hunter2")
+	assert.Nil(t, err)
+	vault.Set("short", "abc")
+	vault.Set("long", "abcdef")
+	vault.Set("empty", "")
+	session := pia.NewSession()
+	in := squeak.NewInterpreter("", io.Discard)
+	in.Declare("session", session)
+	program, err := squeak.ParseString(`
+		session.secret("token", "t0k3n");
+		session.visible = "example";
+	`)
+	assert.Nil(t, err)
+	assert.Nil(t, in.Execute(program))
+	resolver := pia.DelegatingKeyResolver{
+		Delegates: map[string]pia.KeyResolver{
+			"vault":   vault,
+			"session": session,
+			"props":   pia.MapResolver{"host": "example.com"},
+		},
+	}
+	text := "Authorization: abcdef\nX-Key: abc\nX-Token: t0k3n\nHost: example.com"
+	assert.Equal(
+		t,
+		"Authorization: ********\nX-Key: ********\nX-Token: ********\nHost: example.com",
+		pia.Redact(resolver, text),
+	)
+	assert.Equal(t, text, pia.Redact(pia.MapResolver{"key": "abc"}, text))
+	assert.False(t, strings.Contains(pia.Redact(vault, text), "abc"))
+}